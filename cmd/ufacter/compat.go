@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lzap/ufacter/lib/ufacter"
+)
+
+// runCompat compares saved facter output with native facts collected now,
+// returns exit status 0 when all facter facts are identical, 1 when some
+// differ and 2 on error
+func runCompat(args []string) int {
+	fs := flag.NewFlagSet("compat", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s compat [options] facter.(json|yaml)\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	jsonFormat := fs.Bool("json", false, "Print report in JSON format")
+	verbose := fs.Bool("verbose", false, "List facts which differ or are missing")
+	noVolatile := fs.Bool("no-volatile", false, "Ignore facts which are volatile in ufacter")
+	modules := fs.String("modules", defaultModules, "Modules to run")
+	ignore := fs.String("ignore", "", "Ignore facts matching patterns including their children (comma separated, e.g. dmi.bios)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	facter, err := ufacter.LoadSnapshot(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	// extended facts are not part of facter
+	collected := ufacter.Collect(selectReporters(*modules), true, false)
+	native, err := ufacter.FlattenFacts(collected)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	patterns := strings.Split(*ignore, ",")
+	if *noVolatile {
+		for _, f := range collected {
+			if f.Volatile {
+				patterns = append(patterns, f.NameDots())
+			}
+		}
+	}
+	facts := make([]ufacter.CompatFact, 0)
+	for _, c := range ufacter.Compat(facter, native) {
+		if !matchesAny(c.Name, patterns) {
+			facts = append(facts, c)
+		}
+	}
+	trees := ufacter.CompatTrees(facts)
+
+	if *jsonFormat {
+		report := map[string]interface{}{"trees": trees}
+		if *verbose {
+			different := make([]ufacter.CompatFact, 0)
+			for _, c := range facts {
+				if c.Status != ufacter.CompatIdentical {
+					different = append(different, c)
+				}
+			}
+			report["facts"] = different
+		}
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		fmt.Println(string(b))
+	} else {
+		if *verbose {
+			for _, c := range facts {
+				switch c.Status {
+				case ufacter.CompatMissing:
+					fmt.Printf("missing %s: %s\n", c.Name, formatValue(c.Facter))
+				case ufacter.CompatValue, ufacter.CompatType:
+					fmt.Printf("%-7s %s: %s => %s\n", c.Status, c.Name, formatValue(c.Facter), formatValue(c.Ufacter))
+				}
+			}
+			fmt.Println()
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(w, "tree\ttotal\tidentical\tvalue\ttype\tmissing\tcompatible\t")
+		for _, t := range trees {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%.1f%%\t\n", t.Name, t.Total, t.Identical, t.Value, t.Type, t.Missing, t.Percent)
+		}
+		w.Flush()
+	}
+	if total := trees[len(trees)-1]; total.Identical < total.Total {
+		return 1
+	}
+	return 0
+}
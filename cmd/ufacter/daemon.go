@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lzap/ufacter/lib/ufacter"
+	n "github.com/vishvananda/netlink"
+)
+
+// networkModules are re-collected immediately on netlink events
+var networkModules = []string{"link", "net", "route"}
+
+// netlinkDebounce groups bursts of netlink events into one collection
+const netlinkDebounce = 2 * time.Second
+
+// daemon periodically collects facts and runs actions when stable facts change
+type daemon struct {
+	modules  []string
+	custom   []ufacter.Fact
+	volatile bool
+	extended bool
+	interval time.Duration
+
+	// actions
+	file string
+	url  string
+	hook string
+
+	// last facts by module
+	facts  map[string][]ufacter.Fact
+	stable map[string]interface{}
+}
+
+// collect runs reporters of listed modules concurrently and stores facts
+func (d *daemon) collect(modules []string) {
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	for _, mod := range modules {
+		r := reporterByName(mod)
+		if r == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(mod string, r ufacter.Reporter) {
+			defer wg.Done()
+			facts := ufacter.Collect([]ufacter.Reporter{r}, d.volatile, d.extended)
+			mutex.Lock()
+			d.facts[mod] = facts
+			mutex.Unlock()
+		}(mod, r)
+	}
+	wg.Wait()
+}
+
+// all returns custom facts and facts of all modules
+func (d *daemon) all() []ufacter.Fact {
+	result := append([]ufacter.Fact{}, d.custom...)
+	for _, mod := range d.modules {
+		result = append(result, d.facts[mod]...)
+	}
+	return result
+}
+
+// writeFile writes all facts in JSON into the file action
+func (d *daemon) writeFile(facts []ufacter.Fact) {
+	formatter := ufacter.NewJSONFormatter()
+	for _, f := range facts {
+		formatter.Add(f)
+	}
+	if err := ufacter.WriteFileAtomic(d.file, []byte(formatter.IntentJSONString()), 0644); err != nil {
+		log.Printf("Unable to write %s: %v", d.file, err)
+	}
+}
+
+// baseline collects all modules and remembers stable facts without running
+// change actions, only the file is written so it is current from the start
+func (d *daemon) baseline() {
+	d.collect(d.modules)
+	facts := d.all()
+	d.stable = ufacter.FactMap(facts, false)
+	if d.file != "" {
+		d.writeFile(facts)
+	}
+}
+
+// run collects modules and runs actions when stable facts changed
+func (d *daemon) run(modules []string) {
+	d.collect(modules)
+	facts := d.all()
+	stable := ufacter.FactMap(facts, false)
+	changes := ufacter.Diff(d.stable, stable)
+	d.stable = stable
+	if len(changes) == 0 {
+		return
+	}
+	log.Printf("%d facts changed", len(changes))
+	diff, err := json.MarshalIndent(changes, "", "  ")
+	if err != nil {
+		log.Printf("Unable to encode changes: %v", err)
+		return
+	}
+	if d.file != "" {
+		d.writeFile(facts)
+	}
+	if d.url != "" {
+		if err := postChanges(d.url, diff); err != nil {
+			log.Printf("Unable to post changes to %s: %v", d.url, err)
+		}
+	}
+	if d.hook != "" {
+		if err := runHook(d.hook, diff); err != nil {
+			log.Printf("Hook %s failed: %v", d.hook, err)
+		}
+	}
+}
+
+func postChanges(url string, diff []byte) error {
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(diff))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// runHook runs command via shell with changes in JSON on standard input
+func runHook(hook string, diff []byte) error {
+	cmd := exec.Command("/bin/sh", "-c", hook)
+	cmd.Stdin = bytes.NewReader(diff)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// netlinkSubscription receives link, address and route updates, netlink
+// closes an update channel on receive error (e.g. ENOBUFS on route floods)
+type netlinkSubscription struct {
+	done   chan struct{}
+	links  chan n.LinkUpdate
+	addrs  chan n.AddrUpdate
+	routes chan n.RouteUpdate
+}
+
+// subscribe starts link, address and route subscriptions
+func subscribe() (*netlinkSubscription, error) {
+	s := &netlinkSubscription{done: make(chan struct{})}
+	logError := func(err error) {
+		select {
+		case <-s.done:
+			// socket closed by close()
+		default:
+			log.Printf("Netlink subscription error: %v", err)
+		}
+	}
+	links := make(chan n.LinkUpdate)
+	err := n.LinkSubscribeWithOptions(links, s.done, n.LinkSubscribeOptions{ErrorCallback: logError})
+	if err == nil {
+		s.links = links
+		addrs := make(chan n.AddrUpdate)
+		err = n.AddrSubscribeWithOptions(addrs, s.done, n.AddrSubscribeOptions{ErrorCallback: logError})
+		if err == nil {
+			s.addrs = addrs
+		}
+	}
+	if err == nil {
+		routes := make(chan n.RouteUpdate)
+		err = n.RouteSubscribeWithOptions(routes, s.done, n.RouteSubscribeOptions{ErrorCallback: logError})
+		if err == nil {
+			s.routes = routes
+		}
+	}
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// close stops subscriptions and drains channels until netlink closes them,
+// so its goroutines blocked on sending an update can exit
+func (s *netlinkSubscription) close() {
+	close(s.done)
+	if s.links != nil {
+		go func() {
+			for range s.links {
+			}
+		}()
+	}
+	if s.addrs != nil {
+		go func() {
+			for range s.addrs {
+			}
+		}()
+	}
+	if s.routes != nil {
+		go func() {
+			for range s.routes {
+			}
+		}()
+	}
+}
+
+// subscribeNetlink returns channel receiving a value on link, address or
+// route change, it is nil when subscription is not possible; when netlink
+// closes a subscription it is renewed and a change is reported because
+// updates may have been lost
+func subscribeNetlink() <-chan struct{} {
+	s, err := subscribe()
+	if err != nil {
+		log.Printf("Unable to subscribe to netlink changes: %v", err)
+		return nil
+	}
+	events := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case events <- struct{}{}:
+		default:
+		}
+	}
+	go func() {
+		for {
+			ok := true
+			select {
+			case _, ok = <-s.links:
+			case _, ok = <-s.addrs:
+			case _, ok = <-s.routes:
+			}
+			notify()
+			if ok {
+				continue
+			}
+			s.close()
+			time.Sleep(netlinkDebounce)
+			if s, err = subscribe(); err != nil {
+				log.Printf("Unable to subscribe to netlink changes, stopped watching: %v", err)
+				return
+			}
+		}
+	}()
+	return events
+}
+
+// runDaemon collects facts in interval and on network changes, it never returns
+func runDaemon(d *daemon) {
+	d.facts = make(map[string][]ufacter.Fact)
+	d.baseline()
+
+	network := []string{}
+	for _, mod := range d.modules {
+		for _, nm := range networkModules {
+			if mod == nm {
+				network = append(network, mod)
+			}
+		}
+	}
+	var events <-chan struct{}
+	if len(network) > 0 {
+		if events = subscribeNetlink(); events != nil {
+			log.Printf("Watching netlink events for %s", strings.Join(network, ","))
+		}
+	}
+
+	ticker := time.NewTicker(d.interval)
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ticker.C:
+			d.run(d.modules)
+		case <-events:
+			if debounce == nil {
+				debounce = time.After(netlinkDebounce)
+			}
+		case <-debounce:
+			debounce = nil
+			d.run(network)
+		}
+	}
+}
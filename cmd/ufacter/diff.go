@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lzap/ufacter/lib/ufacter"
+)
+
+// matchesAny returns true when name or any of its parents matches a pattern
+func matchesAny(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if p == "" {
+			continue
+		}
+		if ok, _ := filepath.Match(p, name); ok || strings.HasPrefix(name, p+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func formatValue(value interface{}) string {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(b)
+}
+
+// runDiff compares two snapshots and returns exit status like diff(1): 0 when
+// snapshots are same, 1 when they differ and 2 on error
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s diff [options] old.(json|yaml) new.(json|yaml)\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	jsonFormat := fs.Bool("json", false, "Print changes in JSON format")
+	noVolatile := fs.Bool("no-volatile", false, "Ignore facts which ufacter reports as volatile (e.g. usage, counters, uptime)")
+	ignore := fs.String("ignore", "", "Ignore facts matching patterns including their children (comma separated, e.g. ufacter.*,dmi.bios)")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	old, err := ufacter.LoadSnapshot(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	new, err := ufacter.LoadSnapshot(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	patterns := strings.Split(*ignore, ",")
+	changes := make([]ufacter.Change, 0)
+	for _, c := range ufacter.Diff(old, new) {
+		if *noVolatile && ufacter.IsVolatilePath(c.Name) {
+			continue
+		}
+		if !matchesAny(c.Name, patterns) {
+			changes = append(changes, c)
+		}
+	}
+
+	if *jsonFormat {
+		b, err := json.MarshalIndent(changes, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		fmt.Println(string(b))
+	} else {
+		for _, c := range changes {
+			switch c.Kind {
+			case ufacter.ChangeAdded:
+				fmt.Printf("+ %s: %s\n", c.Name, formatValue(c.New))
+			case ufacter.ChangeRemoved:
+				fmt.Printf("- %s: %s\n", c.Name, formatValue(c.Old))
+			default:
+				fmt.Printf("~ %s: %s => %s\n", c.Name, formatValue(c.Old), formatValue(c.New))
+			}
+		}
+	}
+	if len(changes) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lzap/ufacter/lib/ufacter"
+)
+
+// stableTTL is how long stable facts are cached in serve mode
+var stableTTL = 5 * time.Minute
+
+// factServer serves facts over HTTP, stable facts are cached and reporters
+// which report volatile facts run on each request, reporters with stable facts
+// only run when the cache expires
+type factServer struct {
+	reporters []ufacter.Reporter
+	custom    []ufacter.Fact
+	volatile  bool
+	extended  bool
+
+	mutex     sync.Mutex
+	stable    [][]ufacter.Fact
+	dynamic   []bool
+	refreshed time.Time
+}
+
+// collectEach runs reporters concurrently and returns facts of each reporter,
+// reporters which are not selected return no facts
+func collectEach(reporters []ufacter.Reporter, selected []bool, volatile bool, extended bool) [][]ufacter.Fact {
+	result := make([][]ufacter.Fact, len(reporters))
+	var wg sync.WaitGroup
+	for i, r := range reporters {
+		if !selected[i] {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, r ufacter.Reporter) {
+			defer wg.Done()
+			result[i] = ufacter.Collect([]ufacter.Reporter{r}, volatile, extended)
+		}(i, r)
+	}
+	wg.Wait()
+	return result
+}
+
+// isStats returns true for collection time which every reporter sends
+func isStats(f ufacter.Fact) bool {
+	return len(f.Name) > 1 && f.Name[0] == "ufacter" && f.Name[1] == "stats"
+}
+
+// facts returns cached stable facts merged with fresh volatile facts,
+// collection runs without the lock so requests are not serialized
+func (s *factServer) facts() []ufacter.Fact {
+	s.mutex.Lock()
+	fresh := s.stable == nil || time.Since(s.refreshed) > stableTTL
+	stable, dynamic := s.stable, s.dynamic
+	s.mutex.Unlock()
+
+	selected := make([]bool, len(s.reporters))
+	for i := range s.reporters {
+		selected[i] = fresh || (s.volatile && dynamic[i])
+	}
+	collected := collectEach(s.reporters, selected, s.volatile, s.extended)
+	if fresh {
+		stable = make([][]ufacter.Fact, len(s.reporters))
+		dynamic = make([]bool, len(s.reporters))
+		for i, facts := range collected {
+			for _, f := range facts {
+				if !f.Volatile {
+					stable[i] = append(stable[i], f)
+				} else if !isStats(f) {
+					dynamic[i] = true
+				}
+			}
+		}
+		s.mutex.Lock()
+		s.stable, s.dynamic, s.refreshed = stable, dynamic, time.Now()
+		s.mutex.Unlock()
+	}
+
+	result := append([]ufacter.Fact{}, s.custom...)
+	for i := range s.reporters {
+		result = append(result, stable[i]...)
+		for _, f := range collected[i] {
+			if f.Volatile {
+				result = append(result, f)
+			}
+		}
+	}
+	return result
+}
+
+// factsHandler returns fact tree in YAML or JSON depending on Accept header
+func (s *factServer) factsHandler(w http.ResponseWriter, r *http.Request) {
+	facts := s.facts()
+	if strings.Contains(r.Header.Get("Accept"), "yaml") {
+		formatter := ufacter.NewYAMLFormatter()
+		for _, f := range facts {
+			formatter.Add(f)
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		fmt.Fprint(w, formatter.YAMLString())
+		return
+	}
+	formatter := ufacter.NewJSONFormatter()
+	for _, f := range facts {
+		formatter.Add(f)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, formatter.IntentJSONString())
+}
+
+// metricsHandler returns facts in Prometheus text format
+func (s *factServer) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	formatter := ufacter.NewPrometheusFormatter()
+	for _, f := range s.facts() {
+		formatter.Add(f)
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprint(w, formatter.PrometheusString())
+}
+
+// serveFacts starts HTTP server, it only returns on error
+func serveFacts(addr string, reporters []ufacter.Reporter, custom []ufacter.Fact, volatile bool, extended bool) {
+	s := &factServer{
+		reporters: reporters,
+		custom:    custom,
+		volatile:  volatile,
+		extended:  extended,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/facts", s.factsHandler)
+	mux.HandleFunc("/metrics", s.metricsHandler)
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
@@ -2,7 +2,7 @@
 #
 # Show differences against facter4
 #
-# go get github.com/homeport/dyff/cmd/dyff
+# Extra arguments are passed to ufacter diff (e.g. -json)
 #
 
 TEMP=$(mktemp -d)
@@ -11,4 +11,4 @@ trap 'rm -rf $TEMP' EXIT
 facter -y > "$TEMP/facter.yaml"
 ./ufacter-linux-amd64 -yaml > "$TEMP/ufacter.yaml"
 
-dyff between "$TEMP/facter.yaml" "$TEMP/ufacter.yaml"
+./ufacter-linux-amd64 diff -no-volatile "$@" "$TEMP/facter.yaml" "$TEMP/ufacter.yaml"
@@ -2,7 +2,7 @@
 #
 # Show differences against facter4
 #
-# go get github.com/homeport/dyff/cmd/dyff
+# Extra arguments are passed to ufacter diff (e.g. -json)
 #
 
 TEMP=$(mktemp -d)
@@ -11,4 +11,4 @@ trap 'rm -rf $TEMP' EXIT
 ./ufacter-linux-amd64 -yaml > "$TEMP/ufacter.yaml"
 ./ufacter-linux-amd64 -yaml -no-extended > "$TEMP/ufacter-no-extended.yaml"
 
-dyff between "$TEMP/ufacter.yaml" "$TEMP/ufacter-no-extended.yaml"
+./ufacter-linux-amd64 diff "$@" "$TEMP/ufacter.yaml" "$TEMP/ufacter-no-extended.yaml"
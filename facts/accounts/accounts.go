@@ -0,0 +1,353 @@
+package accounts
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	c "github.com/lzap/ufacter/facts/common"
+	"github.com/lzap/ufacter/lib/ufacter"
+)
+
+// fallbackSudoGroups are used when sudoers files are not readable
+var fallbackSudoGroups = []string{"admin", "sudo", "wheel"}
+
+// user represents a local user from passwd file
+type user struct {
+	name  string
+	uid   uint64
+	gid   uint64
+	gecos string
+	home  string
+	shell string
+}
+
+// group represents a local group
+type group struct {
+	name    string
+	gid     uint64
+	members []string
+}
+
+// shadowEntry holds password status without the hash itself, dates are
+// days since epoch and -1 when not set
+type shadowEntry struct {
+	password   string
+	lastChange int64
+	maxDays    int64
+	expire     int64
+}
+
+// colonFile reads colon separated database, comments and empty lines are
+// skipped as well as NIS compat entries
+func colonFile(filename string, fields int) ([][]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	result := [][]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' || line[0] == '+' || line[0] == '-' {
+			continue
+		}
+		split := strings.Split(line, ":")
+		if len(split) < fields {
+			continue
+		}
+		result = append(result, split)
+	}
+	return result, scanner.Err()
+}
+
+func parsePasswd(filename string) ([]user, error) {
+	entries, err := colonFile(filename, 7)
+	if err != nil {
+		return nil, err
+	}
+	result := []user{}
+	for _, e := range entries {
+		uid, err := strconv.ParseUint(e[2], 10, 32)
+		if err != nil {
+			continue
+		}
+		gid, err := strconv.ParseUint(e[3], 10, 32)
+		if err != nil {
+			continue
+		}
+		result = append(result, user{name: e[0], uid: uid, gid: gid, gecos: e[4], home: e[5], shell: e[6]})
+	}
+	return result, nil
+}
+
+func parseGroup(filename string) ([]group, error) {
+	entries, err := colonFile(filename, 4)
+	if err != nil {
+		return nil, err
+	}
+	result := []group{}
+	for _, e := range entries {
+		gid, err := strconv.ParseUint(e[2], 10, 32)
+		if err != nil {
+			continue
+		}
+		g := group{name: e[0], gid: gid, members: []string{}}
+		for _, member := range strings.Split(e[3], ",") {
+			if member = strings.TrimSpace(member); member != "" {
+				g.members = append(g.members, member)
+			}
+		}
+		result = append(result, g)
+	}
+	return result, nil
+}
+
+func parseDays(value string) int64 {
+	days, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return days
+}
+
+// passwordStatus describes password hash field without revealing it
+func passwordStatus(hash string) string {
+	switch {
+	case hash == "":
+		return "empty"
+	case hash[0] == '!':
+		return "locked"
+	case hash[0] == '*':
+		return "disabled"
+	}
+	return "set"
+}
+
+func parseShadow(filename string) (map[string]*shadowEntry, error) {
+	entries, err := colonFile(filename, 8)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*shadowEntry)
+	for _, e := range entries {
+		result[e[0]] = &shadowEntry{
+			password:   passwordStatus(e[1]),
+			lastChange: parseDays(e[2]),
+			maxDays:    parseDays(e[4]),
+			expire:     parseDays(e[7]),
+		}
+	}
+	return result, nil
+}
+
+// parseSudoers returns groups and users granted privileges in sudoers
+// files, aliases and Defaults are ignored
+func parseSudoers(filename string, groups map[string]bool, users map[string]bool) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "@") {
+			continue
+		}
+		for _, name := range strings.Split(fields[0], ",") {
+			switch {
+			case name == "" || name == "Defaults" || strings.HasPrefix(name, "Defaults") ||
+				strings.HasSuffix(name, "_Alias") || name == "ALL":
+				continue
+			case strings.HasPrefix(name, "%"):
+				groups[strings.TrimPrefix(name[1:], ":")] = true
+			case strings.ToUpper(name) == name:
+				// alias name
+				continue
+			default:
+				users[name] = true
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// readSudoers parses sudoers and sudoers.d files skipping names sudo
+// ignores (containing a dot or ending with tilde)
+func readSudoers(etc string) (map[string]bool, map[string]bool, error) {
+	groups := make(map[string]bool)
+	users := make(map[string]bool)
+	if err := parseSudoers(filepath.Join(etc, "sudoers"), groups, users); err != nil {
+		return nil, nil, err
+	}
+	dir := filepath.Join(etc, "sudoers.d")
+	entries, err := ioutil.ReadDir(dir)
+	if err == nil {
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || strings.Contains(name, ".") || strings.HasSuffix(name, "~") {
+				continue
+			}
+			if err := parseSudoers(filepath.Join(dir, name), groups, users); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return groups, users, nil
+}
+
+// memberships returns sorted group names for each user including primary group
+func memberships(users []user, groups []group) map[string][]string {
+	names := make(map[uint64]string)
+	for _, g := range groups {
+		if _, ok := names[g.gid]; !ok {
+			names[g.gid] = g.name
+		}
+	}
+	seen := make(map[string]map[string]bool)
+	for _, u := range users {
+		seen[u.name] = make(map[string]bool)
+		if name, ok := names[u.gid]; ok {
+			seen[u.name][name] = true
+		}
+	}
+	for _, g := range groups {
+		for _, member := range g.members {
+			if _, ok := seen[member]; ok {
+				seen[member][g.name] = true
+			}
+		}
+	}
+	result := make(map[string][]string)
+	for name, set := range seen {
+		list := []string{}
+		for g := range set {
+			list = append(list, g)
+		}
+		sort.Strings(list)
+		result[name] = list
+	}
+	return result
+}
+
+// sudoUsers returns sorted users which are sudoers directly or via group
+func sudoUsers(users []user, memberOf map[string][]string, sudoGroups map[string]bool, direct map[string]bool) []string {
+	result := make(map[string]bool)
+	for name := range direct {
+		result[name] = true
+	}
+	for _, u := range users {
+		for _, g := range memberOf[u.name] {
+			if sudoGroups[g] {
+				result[u.name] = true
+			}
+		}
+	}
+	list := []string{}
+	for name := range result {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func sortedKeys(set map[string]bool) []string {
+	result := []string{}
+	for key := range set {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// daysToDate converts days since epoch to ISO date
+func daysToDate(days int64) string {
+	return time.Unix(days*86400, 0).UTC().Format("2006-01-02")
+}
+
+// reportShadow sends lock and expiry status of an account
+func reportShadow(facts chan<- ufacter.Fact, name string, s *shadowEntry, now time.Time) {
+	today := now.Unix() / 86400
+	facts <- ufacter.NewStableFactEx(s.password, "accounts", "users", name, "password")
+	facts <- ufacter.NewStableFactEx(s.password == "locked", "accounts", "users", name, "locked")
+	if s.expire >= 0 {
+		facts <- ufacter.NewStableFactEx(daysToDate(s.expire), "accounts", "users", name, "expires")
+	}
+	facts <- ufacter.NewStableFactEx(s.expire >= 0 && s.expire <= today, "accounts", "users", name, "expired")
+	if s.lastChange > 0 {
+		facts <- ufacter.NewStableFactEx(daysToDate(s.lastChange), "accounts", "users", name, "password_changed")
+	}
+	if s.lastChange >= 0 && s.maxDays >= 0 && s.maxDays < 99999 {
+		facts <- ufacter.NewStableFactEx(daysToDate(s.lastChange+s.maxDays), "accounts", "users", name, "password_expires")
+	}
+}
+
+// ReportFacts reports local users, groups and sudoers, password hashes are
+// never reported
+func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
+	start := time.Now()
+	defer ufacter.SendLastFact(facts)
+	etc := c.GetHostEtc()
+
+	users, err := parsePasswd(filepath.Join(etc, "passwd"))
+	if err != nil {
+		c.LogError(facts, err, "accounts", "passwd")
+		return
+	}
+	groups, err := parseGroup(filepath.Join(etc, "group"))
+	if err != nil {
+		c.LogError(facts, err, "accounts", "group")
+	}
+	// shadow is only readable by root
+	shadow, err := parseShadow(filepath.Join(etc, "shadow"))
+	if err != nil && !os.IsPermission(err) && !os.IsNotExist(err) {
+		c.LogError(facts, err, "accounts", "shadow")
+	}
+
+	memberOf := memberships(users, groups)
+	for _, u := range users {
+		facts <- ufacter.NewStableFactEx(u.uid, "accounts", "users", u.name, "uid")
+		facts <- ufacter.NewStableFactEx(u.gid, "accounts", "users", u.name, "gid")
+		facts <- ufacter.NewStableFactEx(u.gecos, "accounts", "users", u.name, "gecos")
+		facts <- ufacter.NewStableFactEx(u.home, "accounts", "users", u.name, "home")
+		facts <- ufacter.NewStableFactEx(u.shell, "accounts", "users", u.name, "shell")
+		facts <- ufacter.NewStableFactEx(memberOf[u.name], "accounts", "users", u.name, "groups")
+		if s, ok := shadow[u.name]; ok {
+			reportShadow(facts, u.name, s, start)
+		}
+	}
+	for _, g := range groups {
+		facts <- ufacter.NewStableFactEx(g.gid, "accounts", "groups", g.name, "gid")
+		facts <- ufacter.NewStableFactEx(g.members, "accounts", "groups", g.name, "members")
+	}
+
+	// sudoers is only readable by root, well-known groups are used otherwise
+	sudoGroups, direct, err := readSudoers(etc)
+	if err != nil {
+		if !os.IsPermission(err) && !os.IsNotExist(err) {
+			c.LogError(facts, err, "accounts", "sudoers")
+		}
+		sudoGroups = make(map[string]bool)
+		direct = make(map[string]bool)
+		for _, g := range groups {
+			for _, name := range fallbackSudoGroups {
+				if g.name == name {
+					sudoGroups[name] = true
+				}
+			}
+		}
+	}
+	facts <- ufacter.NewStableFactEx(sortedKeys(sudoGroups), "accounts", "sudoers", "groups")
+	facts <- ufacter.NewStableFactEx(sudoUsers(users, memberOf, sudoGroups, direct), "accounts", "sudoers", "users")
+
+	ufacter.SendVolatileFactEx(facts, time.Since(start), "ufacter", "stats", "accounts")
+}
@@ -0,0 +1,98 @@
+package accounts
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var testEtc = filepath.Join("testdata", "etc")
+
+func TestParsePasswd(t *testing.T) {
+	users, err := parsePasswd(filepath.Join(testEtc, "passwd"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(users) != 5 {
+		t.Fatalf("expected 5 users, got %v", users)
+	}
+	expected := user{"alice", 1000, 1000, "Alice Example,,,", "/home/alice", "/bin/bash"}
+	if users[2] != expected {
+		t.Fatalf("%v != %v", users[2], expected)
+	}
+}
+
+func TestParseShadow(t *testing.T) {
+	shadow, err := parseShadow(filepath.Join(testEtc, "shadow"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := map[string]shadowEntry{
+		"root":  {"set", 19000, 99999, -1},
+		"bin":   {"disabled", 19000, 99999, -1},
+		"alice": {"set", 19500, 90, -1},
+		"bob":   {"locked", 19000, 99999, 19100},
+		"svc":   {"locked", 19000, -1, -1},
+	}
+	result := make(map[string]shadowEntry)
+	for name, s := range shadow {
+		result[name] = *s
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+}
+
+func TestMemberships(t *testing.T) {
+	users, err := parsePasswd(filepath.Join(testEtc, "passwd"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	groups, err := parseGroup(filepath.Join(testEtc, "group"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	memberOf := memberships(users, groups)
+	expected := map[string][]string{
+		"root":  {"root"},
+		"bin":   {"bin"},
+		"alice": {"alice", "docker", "wheel"},
+		"bob":   {"bob", "docker", "ops"},
+		"svc":   {"docker"},
+	}
+	if !reflect.DeepEqual(memberOf, expected) {
+		t.Fatalf("%v != %v", memberOf, expected)
+	}
+
+	sudoGroups, direct, err := readSudoers(testEtc)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if keys := sortedKeys(sudoGroups); !reflect.DeepEqual(keys, []string{"ops", "wheel"}) {
+		t.Fatalf("%v != [ops wheel]", keys)
+	}
+	sudoers := sudoUsers(users, memberOf, sudoGroups, direct)
+	if !reflect.DeepEqual(sudoers, []string{"alice", "bob", "root"}) {
+		t.Fatalf("%v != [alice bob root]", sudoers)
+	}
+}
+
+type passwordTPair struct {
+	input    string
+	expected string
+}
+
+func TestPasswordStatus(t *testing.T) {
+	tests := []passwordTPair{
+		{"", "empty"},
+		{"!", "locked"},
+		{"!!", "locked"},
+		{"*", "disabled"},
+		{"$y$j9T$salt$hash", "set"},
+	}
+	for _, pair := range tests {
+		if result := passwordStatus(pair.input); result != pair.expected {
+			t.Fatalf("%v != %v", result, pair.expected)
+		}
+	}
+}
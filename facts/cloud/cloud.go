@@ -0,0 +1,358 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	c "github.com/lzap/ufacter/facts/common"
+	"github.com/lzap/ufacter/lib/ufacter"
+)
+
+// DefaultMetadataURL is the link-local address of instance metadata service
+// shared by all supported providers
+const DefaultMetadataURL = "http://169.254.169.254"
+
+var (
+	// MetadataURL is base URL of instance metadata service (e.g. stub server)
+	MetadataURL = DefaultMetadataURL
+	// Timeout for all metadata requests of a single provider
+	Timeout = 2 * time.Second
+)
+
+// Azure sets this chassis asset tag on all virtual machines
+const azureAssetTag = "7783-7084-3265-9085-8269-3286-77"
+
+// instance represents metadata common to all cloud providers
+type instance struct {
+	id        string
+	kind      string
+	region    string
+	zone      string
+	image     string
+	publicIP  string
+	privateIP string
+	// EC2 compatible metadata reported in "ec2_metadata" tree
+	ec2 map[string]interface{}
+}
+
+// provider detects a cloud from DMI strings and fetches instance metadata
+type provider struct {
+	name   string
+	detect func(dmi map[string]string) bool
+	fetch  func(ctx context.Context, client *http.Client, base string) (*instance, error)
+}
+
+var providers = []provider{
+	{"openstack", detectOpenStack, fetchOpenStack},
+	{"aws", detectAWS, fetchAWS},
+	{"gce", detectGCE, fetchGCE},
+	{"azure", detectAzure, fetchAzure},
+}
+
+// DMI fields used for cloud detection
+var dmiFields = []string{"sys_vendor", "product_name", "product_version", "bios_vendor", "bios_version", "chassis_asset_tag"}
+
+func readDMI(sys string) map[string]string {
+	dmi := make(map[string]string)
+	for _, field := range dmiFields {
+		value, err := c.ReadFileString(filepath.Join(sys, "class", "dmi", "id", field))
+		if err == nil {
+			dmi[field] = value
+		}
+	}
+	return dmi
+}
+
+func detectAWS(dmi map[string]string) bool {
+	return dmi["sys_vendor"] == "Amazon EC2" || dmi["bios_vendor"] == "Amazon EC2" ||
+		strings.Contains(strings.ToLower(dmi["bios_version"]), "amazon")
+}
+
+func detectGCE(dmi map[string]string) bool {
+	return dmi["product_name"] == "Google Compute Engine" || dmi["sys_vendor"] == "Google"
+}
+
+func detectAzure(dmi map[string]string) bool {
+	return dmi["chassis_asset_tag"] == azureAssetTag
+}
+
+func detectOpenStack(dmi map[string]string) bool {
+	return strings.HasPrefix(dmi["product_name"], "OpenStack") || dmi["sys_vendor"] == "OpenStack Foundation"
+}
+
+// detectProvider returns provider detected from DMI strings under given sysfs
+// path or nil when not running in a known cloud
+func detectProvider(sys string) *provider {
+	dmi := readDMI(sys)
+	for i := range providers {
+		if providers[i].detect(dmi) {
+			return &providers[i]
+		}
+	}
+	return nil
+}
+
+// get performs metadata request and returns body, 404 is returned as empty
+// string with no error since metadata services use it for unset values
+func get(ctx context.Context, client *http.Client, method string, url string, headers map[string]string) (string, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s %s returned %s", method, url, resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// fetchEC2 reads EC2 compatible metadata, IMDSv2 token is used when given
+func fetchEC2(ctx context.Context, client *http.Client, base string, token string) (*instance, error) {
+	headers := make(map[string]string)
+	if token != "" {
+		headers["X-aws-ec2-metadata-token"] = token
+	}
+	ec2 := make(map[string]interface{})
+	value := func(name string) (string, error) {
+		v, err := get(ctx, client, "GET", base+"/latest/meta-data/"+name, headers)
+		if err != nil || v == "" {
+			return v, err
+		}
+		if dir := path.Dir(name); dir != "." {
+			subtree, ok := ec2[dir].(map[string]interface{})
+			if !ok {
+				subtree = make(map[string]interface{})
+				ec2[dir] = subtree
+			}
+			subtree[path.Base(name)] = v
+		} else {
+			ec2[name] = v
+		}
+		return v, nil
+	}
+
+	result := &instance{ec2: ec2}
+	var err error
+	if result.id, err = value("instance-id"); err != nil {
+		return nil, err
+	}
+	for _, v := range []struct {
+		name  string
+		field *string
+	}{
+		{"instance-type", &result.kind},
+		{"ami-id", &result.image},
+		{"placement/availability-zone", &result.zone},
+		{"placement/region", &result.region},
+		{"local-ipv4", &result.privateIP},
+		{"public-ipv4", &result.publicIP},
+		{"hostname", nil},
+		{"local-hostname", nil},
+		{"public-hostname", nil},
+		{"mac", nil},
+	} {
+		s, err := value(v.name)
+		if err != nil {
+			return nil, err
+		}
+		if v.field != nil {
+			*v.field = s
+		}
+	}
+	return result, nil
+}
+
+func fetchAWS(ctx context.Context, client *http.Client, base string) (*instance, error) {
+	// IMDSv2 session token, IMDSv1 is used when token cannot be obtained
+	token, _ := get(ctx, client, "PUT", base+"/latest/api/token", map[string]string{
+		"X-aws-ec2-metadata-token-ttl-seconds": "60",
+	})
+	return fetchEC2(ctx, client, base, token)
+}
+
+func fetchOpenStack(ctx context.Context, client *http.Client, base string) (*instance, error) {
+	body, err := get(ctx, client, "GET", base+"/openstack/latest/meta_data.json", nil)
+	if err != nil {
+		return nil, err
+	}
+	var meta struct {
+		UUID             string `json:"uuid"`
+		AvailabilityZone string `json:"availability_zone"`
+	}
+	if err := json.Unmarshal([]byte(body), &meta); err != nil {
+		return nil, err
+	}
+	// instance type and addresses are only available via EC2 compatible API
+	result, err := fetchEC2(ctx, client, base, "")
+	if err != nil {
+		return nil, err
+	}
+	result.id = meta.UUID
+	result.zone = meta.AvailabilityZone
+	return result, nil
+}
+
+func fetchGCE(ctx context.Context, client *http.Client, base string) (*instance, error) {
+	body, err := get(ctx, client, "GET", base+"/computeMetadata/v1/instance/?recursive=true", map[string]string{
+		"Metadata-Flavor": "Google",
+	})
+	if err != nil {
+		return nil, err
+	}
+	var meta struct {
+		ID                json.Number `json:"id"`
+		MachineType       string      `json:"machineType"`
+		Zone              string      `json:"zone"`
+		Image             string      `json:"image"`
+		NetworkInterfaces []struct {
+			IP            string `json:"ip"`
+			AccessConfigs []struct {
+				ExternalIP string `json:"externalIp"`
+			} `json:"accessConfigs"`
+		} `json:"networkInterfaces"`
+	}
+	if err := json.Unmarshal([]byte(body), &meta); err != nil {
+		return nil, err
+	}
+	result := &instance{
+		id:    meta.ID.String(),
+		kind:  path.Base(meta.MachineType),
+		zone:  path.Base(meta.Zone),
+		image: path.Base(meta.Image),
+	}
+	if idx := strings.LastIndex(result.zone, "-"); idx > 0 {
+		result.region = result.zone[:idx]
+	}
+	if len(meta.NetworkInterfaces) > 0 {
+		result.privateIP = meta.NetworkInterfaces[0].IP
+		if len(meta.NetworkInterfaces[0].AccessConfigs) > 0 {
+			result.publicIP = meta.NetworkInterfaces[0].AccessConfigs[0].ExternalIP
+		}
+	}
+	return result, nil
+}
+
+func fetchAzure(ctx context.Context, client *http.Client, base string) (*instance, error) {
+	body, err := get(ctx, client, "GET", base+"/metadata/instance?api-version=2021-02-01", map[string]string{
+		"Metadata": "true",
+	})
+	if err != nil {
+		return nil, err
+	}
+	var meta struct {
+		Compute struct {
+			VMID           string `json:"vmId"`
+			VMSize         string `json:"vmSize"`
+			Location       string `json:"location"`
+			Zone           string `json:"zone"`
+			StorageProfile struct {
+				ImageReference struct {
+					Publisher string `json:"publisher"`
+					Offer     string `json:"offer"`
+					Sku       string `json:"sku"`
+					Version   string `json:"version"`
+				} `json:"imageReference"`
+			} `json:"storageProfile"`
+		} `json:"compute"`
+		Network struct {
+			Interface []struct {
+				IPv4 struct {
+					IPAddress []struct {
+						PrivateIPAddress string `json:"privateIpAddress"`
+						PublicIPAddress  string `json:"publicIpAddress"`
+					} `json:"ipAddress"`
+				} `json:"ipv4"`
+			} `json:"interface"`
+		} `json:"network"`
+	}
+	if err := json.Unmarshal([]byte(body), &meta); err != nil {
+		return nil, err
+	}
+	image := meta.Compute.StorageProfile.ImageReference
+	result := &instance{
+		id:     meta.Compute.VMID,
+		kind:   meta.Compute.VMSize,
+		region: meta.Compute.Location,
+		zone:   meta.Compute.Zone,
+	}
+	if image.Publisher != "" {
+		result.image = strings.Join([]string{image.Publisher, image.Offer, image.Sku, image.Version}, ":")
+	}
+	if len(meta.Network.Interface) > 0 && len(meta.Network.Interface[0].IPv4.IPAddress) > 0 {
+		result.privateIP = meta.Network.Interface[0].IPv4.IPAddress[0].PrivateIPAddress
+		result.publicIP = meta.Network.Interface[0].IPv4.IPAddress[0].PublicIPAddress
+	}
+	return result, nil
+}
+
+// query fetches metadata from the service of the provider with a strict timeout
+func (p *provider) query(base string) (*instance, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	client := &http.Client{
+		// metadata services are link-local and must never go through a proxy
+		Transport: &http.Transport{Proxy: nil},
+		Timeout:   Timeout,
+	}
+	return p.fetch(ctx, client, base)
+}
+
+func reportInstance(facts chan<- ufacter.Fact, name string, inst *instance) {
+	facts <- ufacter.NewStableFact(name, "cloud", "provider")
+	facts <- ufacter.NewStableFactEx(inst.id, "cloud", "instance_id")
+	facts <- ufacter.NewStableFactEx(inst.kind, "cloud", "instance_type")
+	facts <- ufacter.NewStableFactEx(inst.region, "cloud", "region")
+	facts <- ufacter.NewStableFactEx(inst.zone, "cloud", "zone")
+	facts <- ufacter.NewStableFactEx(inst.image, "cloud", "image")
+	facts <- ufacter.NewStableFactEx(inst.publicIP, "cloud", "public_ip")
+	facts <- ufacter.NewStableFactEx(inst.privateIP, "cloud", "private_ip")
+	for key, value := range inst.ec2 {
+		facts <- ufacter.NewStableFact(value, "ec2_metadata", key)
+	}
+}
+
+// ReportFacts detects cloud provider and reports instance metadata, nothing is
+// queried on hosts which are not detected as cloud instances
+func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
+	start := time.Now()
+	defer ufacter.SendLastFact(facts)
+	if c.SkipOffline(facts, "cloud") {
+		return
+	}
+
+	p := detectProvider(c.GetHostSys())
+	if p == nil {
+		return
+	}
+
+	inst, err := p.query(strings.TrimRight(MetadataURL, "/"))
+	if err == nil {
+		reportInstance(facts, p.name, inst)
+	} else {
+		c.LogError(facts, err, "cloud", p.name)
+	}
+
+	ufacter.SendVolatileFactEx(facts, time.Since(start), "ufacter", "stats", "cloud")
+}
@@ -0,0 +1,253 @@
+package cloud
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lzap/ufacter/lib/ufacter"
+)
+
+const awsToken = "AQAEAHcB-token"
+
+var ec2Metadata = map[string]string{
+	"instance-id":                 "i-0123456789abcdef0",
+	"instance-type":               "m5.large",
+	"ami-id":                      "ami-0abcdef1234567890",
+	"placement/availability-zone": "eu-west-1a",
+	"placement/region":            "eu-west-1",
+	"local-ipv4":                  "172.31.1.10",
+	"public-ipv4":                 "54.1.2.3",
+	"hostname":                    "ip-172-31-1-10.eu-west-1.compute.internal",
+	"mac":                         "0a:1b:2c:3d:4e:5f",
+}
+
+const gceMetadata = `{
+  "id": 4520031799277581759,
+  "machineType": "projects/123456789/machineTypes/e2-medium",
+  "zone": "projects/123456789/zones/us-central1-a",
+  "image": "projects/debian-cloud/global/images/debian-11-bullseye-v20230306",
+  "networkInterfaces": [{"ip": "10.128.0.2", "accessConfigs": [{"externalIp": "34.1.2.3"}]}]
+}`
+
+const azureMetadata = `{
+  "compute": {
+    "vmId": "02aab8a4-74ef-476e-8182-f6d2ba4166a6",
+    "vmSize": "Standard_D2s_v3",
+    "location": "westeurope",
+    "zone": "1",
+    "storageProfile": {"imageReference": {"publisher": "Canonical", "offer": "UbuntuServer", "sku": "18.04-LTS", "version": "latest"}}
+  },
+  "network": {"interface": [{"ipv4": {"ipAddress": [{"privateIpAddress": "10.0.0.4", "publicIpAddress": "20.1.2.3"}]}}]}
+}`
+
+const openstackMetadata = `{"uuid": "d8e02d56-2648-49a3-bf97-6be8f1204f38", "availability_zone": "nova", "name": "web01"}`
+
+// newStubServer returns metadata service stub for all supported providers
+func newStubServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest/api/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, awsToken)
+	})
+	mux.HandleFunc("/latest/meta-data/", func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-aws-ec2-metadata-token")
+		if token != "" && token != awsToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		value, ok := ec2Metadata[r.URL.Path[len("/latest/meta-data/"):]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, value)
+	})
+	mux.HandleFunc("/computeMetadata/v1/instance/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, gceMetadata)
+	})
+	mux.HandleFunc("/metadata/instance", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, azureMetadata)
+	})
+	mux.HandleFunc("/openstack/latest/meta_data.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, openstackMetadata)
+	})
+	return httptest.NewServer(mux)
+}
+
+type detectTPair struct {
+	fixture  string
+	provider string
+}
+
+func TestDetectProvider(t *testing.T) {
+	testPairs := []detectTPair{
+		{"aws", "aws"},
+		{"aws-xen", "aws"},
+		{"gce", "gce"},
+		{"azure", "azure"},
+		{"openstack", "openstack"},
+		{"none", ""},
+	}
+	for _, pair := range testPairs {
+		p := detectProvider(filepath.Join("testdata", pair.fixture))
+		name := ""
+		if p != nil {
+			name = p.name
+		}
+		if name != pair.provider {
+			t.Errorf("%v: '%v' != '%v'", pair.fixture, name, pair.provider)
+		}
+	}
+}
+
+type fetchTPair struct {
+	provider string
+	expected instance
+}
+
+func TestFetch(t *testing.T) {
+	server := newStubServer(t)
+	defer server.Close()
+
+	testPairs := []fetchTPair{
+		{"aws", instance{
+			id: "i-0123456789abcdef0", kind: "m5.large", region: "eu-west-1", zone: "eu-west-1a",
+			image: "ami-0abcdef1234567890", publicIP: "54.1.2.3", privateIP: "172.31.1.10",
+		}},
+		{"gce", instance{
+			id: "4520031799277581759", kind: "e2-medium", region: "us-central1", zone: "us-central1-a",
+			image: "debian-11-bullseye-v20230306", publicIP: "34.1.2.3", privateIP: "10.128.0.2",
+		}},
+		{"azure", instance{
+			id: "02aab8a4-74ef-476e-8182-f6d2ba4166a6", kind: "Standard_D2s_v3", region: "westeurope", zone: "1",
+			image: "Canonical:UbuntuServer:18.04-LTS:latest", publicIP: "20.1.2.3", privateIP: "10.0.0.4",
+		}},
+		{"openstack", instance{
+			id: "d8e02d56-2648-49a3-bf97-6be8f1204f38", kind: "m5.large", region: "eu-west-1", zone: "nova",
+			image: "ami-0abcdef1234567890", publicIP: "54.1.2.3", privateIP: "172.31.1.10",
+		}},
+	}
+	for _, pair := range testPairs {
+		var p *provider
+		for i := range providers {
+			if providers[i].name == pair.provider {
+				p = &providers[i]
+			}
+		}
+		inst, err := p.query(server.URL)
+		if err != nil {
+			t.Fatalf("%v: %v", pair.provider, err)
+		}
+		inst.ec2 = nil
+		if !reflect.DeepEqual(*inst, pair.expected) {
+			t.Errorf("%v: %+v != %+v", pair.provider, *inst, pair.expected)
+		}
+	}
+}
+
+func TestFetchEC2Tree(t *testing.T) {
+	server := newStubServer(t)
+	defer server.Close()
+
+	inst, err := providers[1].query(server.URL)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	placement, ok := inst.ec2["placement"].(map[string]interface{})
+	if !ok || placement["availability-zone"] != "eu-west-1a" {
+		t.Fatalf("unexpected placement %v", inst.ec2["placement"])
+	}
+	if inst.ec2["instance-id"] != "i-0123456789abcdef0" {
+		t.Fatalf("unexpected instance-id %v", inst.ec2["instance-id"])
+	}
+	if _, ok := inst.ec2["public-hostname"]; ok {
+		t.Fatalf("missing values must not be reported")
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	oldTimeout := Timeout
+	Timeout = 50 * time.Millisecond
+	defer func() { Timeout = oldTimeout }()
+
+	begin := time.Now()
+	_, err := providers[2].query(server.URL)
+	if err == nil {
+		t.Fatalf("expected timeout error")
+	}
+	if time.Since(begin) > 400*time.Millisecond {
+		t.Fatalf("timeout not honoured: %v", time.Since(begin))
+	}
+}
+
+func TestReportFactsNotInCloud(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected metadata request %v", r.URL)
+	}))
+	defer server.Close()
+
+	oldURL := MetadataURL
+	MetadataURL = server.URL
+	defer func() { MetadataURL = oldURL }()
+	os.Setenv("HOST_SYS", filepath.Join("testdata", "none"))
+	defer os.Unsetenv("HOST_SYS")
+
+	facts := make(chan ufacter.Fact, 64)
+	ReportFacts(facts, true, true)
+	f := <-facts
+	if f.Name != nil {
+		t.Fatalf("unexpected fact %v", f.NameDots())
+	}
+}
+
+func TestReportFacts(t *testing.T) {
+	server := newStubServer(t)
+	defer server.Close()
+
+	oldURL := MetadataURL
+	MetadataURL = server.URL
+	defer func() { MetadataURL = oldURL }()
+	os.Setenv("HOST_SYS", filepath.Join("testdata", "aws"))
+	defer os.Unsetenv("HOST_SYS")
+
+	facts := make(chan ufacter.Fact, 64)
+	ReportFacts(facts, true, true)
+	reported := make(map[string]interface{})
+	for f := range facts {
+		if f.Name == nil {
+			break
+		}
+		reported[f.NameDots()] = f.Value
+	}
+	if reported["cloud.provider"] != "aws" {
+		t.Fatalf("unexpected provider %v", reported["cloud.provider"])
+	}
+	if reported["cloud.instance_type"] != "m5.large" {
+		t.Fatalf("unexpected instance type %v", reported["cloud.instance_type"])
+	}
+	if reported["ec2_metadata.instance-id"] != "i-0123456789abcdef0" {
+		t.Fatalf("unexpected ec2_metadata %v", reported["ec2_metadata.instance-id"])
+	}
+}
@@ -2,10 +2,13 @@ package common
 
 import (
 	"fmt"
+	"io/ioutil"
 	"math"
 	"net"
 	"os"
+	"path/filepath"
 	"strings"
+	"syscall"
 
 	"github.com/lzap/ufacter/lib/ufacter"
 )
@@ -120,7 +123,7 @@ func IPMaskToString6(mask net.IPMask) string {
 	var maskBuilder strings.Builder
 	maskBuilder.Grow(41)
 	for i, b := range mask {
-		fmt.Fprintf(&maskBuilder, "%x", b)
+		fmt.Fprintf(&maskBuilder, "%02x", b)
 		if i%2 == 1 && i < 15 {
 			maskBuilder.WriteString(":")
 		}
@@ -128,26 +131,181 @@ func IPMaskToString6(mask net.IPMask) string {
 	return net.ParseIP(maskBuilder.String()).String()
 }
 
-func GetHostEtc() string {
-	host_etc := os.Getenv("HOST_ETC")
-	if host_etc == "" {
-		host_etc = "/etc"
+// Binding returns address in the format of networking.interfaces bindings,
+// CIDR is reported only with extended facts
+func Binding(addr *net.IPNet, extended bool) map[string]string {
+	b := make(map[string]string)
+	if extended {
+		b["cidr"] = addr.String()
+	}
+	b["address"] = addr.IP.String()
+	b["network"] = addr.IP.Mask(addr.Mask).String()
+	if addr.IP.To4() != nil {
+		b["netmask"] = IPMaskToString4(addr.Mask)
+	} else {
+		b["netmask"] = IPMaskToString6(addr.Mask)
 	}
-	return host_etc
+	return b
+}
+
+// ReadFileString returns contents of a file with surrounding whitespace removed
+func ReadFileString(filename string) (string, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(contents)), nil
+}
+
+// hostRoot is the filesystem tree set by SetHostRoot, empty when facts are
+// collected from the running system
+var hostRoot string
+
+// hostDirs are top-level directories which can be moved by HOST_* environment
+// variables, gopsutil reads them as well
+var hostDirs = map[string]string{
+	"etc":  "HOST_ETC",
+	"sys":  "HOST_SYS",
+	"proc": "HOST_PROC",
+	"var":  "HOST_VAR",
+	"run":  "HOST_RUN",
+	"dev":  "HOST_DEV",
+}
+
+// HostPath returns path in the filesystem facts are collected from, that is
+// the running system or the tree set by SetHostRoot; directories listed in
+// hostDirs are moved only by their HOST_* variable as gopsutil does, other
+// paths are relative to GetHostRoot
+func HostPath(elem ...string) string {
+	root := GetHostRoot()
+	if len(elem) > 0 {
+		if env, ok := hostDirs[elem[0]]; ok {
+			if dir := os.Getenv(env); dir != "" {
+				return filepath.Join(append([]string{dir}, elem[1:]...)...)
+			}
+			root = "/"
+		}
+	}
+	return filepath.Join(append([]string{root}, elem...)...)
+}
+
+func GetHostEtc() string {
+	return HostPath("etc")
 }
 
 func GetHostSys() string {
-	host_sys := os.Getenv("HOST_SYS")
-	if host_sys == "" {
-		host_sys = "/sys"
+	return HostPath("sys")
+}
+
+func GetHostVar() string {
+	return HostPath("var")
+}
+
+func GetHostRun() string {
+	return HostPath("run")
+}
+
+func GetHostRoot() string {
+	if hostRoot != "" {
+		return hostRoot
+	}
+	host_root := os.Getenv("HOST_ROOT")
+	if host_root == "" {
+		host_root = "/"
 	}
-	return host_sys
+	return host_root
 }
 
 func GetHostProc() string {
-	host_proc := os.Getenv("HOST_PROC")
-	if host_proc == "" {
-		host_proc = "/proc"
+	return HostPath("proc")
+}
+
+// Offline returns true when facts are collected from a filesystem tree set by
+// SetHostRoot, the running system must not be queried then
+func Offline() bool {
+	return hostRoot != ""
+}
+
+// SetHostRoot collects facts from root directory (a mounted disk image,
+// chroot or sosreport-like tree) instead of the running system, HOST_*
+// variables are exported so gopsutil reads the tree too
+func SetHostRoot(root string) error {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Stat(root); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", root)
+	}
+	for dir, env := range hostDirs {
+		if err := os.Setenv(env, filepath.Join(root, dir)); err != nil {
+			return err
+		}
+	}
+	hostRoot = root
+	return nil
+}
+
+// ResetHostRoot collects facts from the running system again
+func ResetHostRoot() {
+	for _, env := range hostDirs {
+		os.Unsetenv(env)
+	}
+	hostRoot = ""
+}
+
+// SkipOffline reports module unavailable and returns true when collecting
+// offline, to be called by reporters which need the running system
+func SkipOffline(facts chan<- ufacter.Fact, module string) bool {
+	if Offline() {
+		facts <- ufacter.NewStableFactEx("not available offline", "ufacter", "unavailable", module)
+	}
+	return Offline()
+}
+
+// Hostname returns host name of the running system or host name stored in
+// the tree when collecting offline
+func Hostname() (string, error) {
+	if !Offline() {
+		return os.Hostname()
+	}
+	hostname, err := ReadFileString(HostPath("proc", "sys", "kernel", "hostname"))
+	if err != nil {
+		hostname, err = ReadFileString(HostPath("etc", "hostname"))
+	}
+	return hostname, err
+}
+
+// Uname returns kernel release and machine hardware name of the running
+// system or from proc tree when collecting offline
+func Uname() (release string, machine string, err error) {
+	if Offline() {
+		release, err = ReadFileString(HostPath("proc", "sys", "kernel", "osrelease"))
+		if err != nil {
+			return "", "", err
+		}
+		// kernel.arch is not available on older kernels
+		machine, _ = ReadFileString(HostPath("proc", "sys", "kernel", "arch"))
+		return release, machine, nil
+	}
+	var uname syscall.Utsname
+	if err := syscall.Uname(&uname); err != nil {
+		return "", "", err
+	}
+	return int8ToString(uname.Release), int8ToString(uname.Machine), nil
+}
+
+// int8ToString converts [65]int8 in syscall.Utsname to string
+func int8ToString(bs [65]int8) string {
+	b := make([]byte, len(bs))
+	for i, v := range bs {
+		if v < 0 {
+			b[i] = byte(256 + int(v))
+		} else {
+			b[i] = byte(v)
+		}
 	}
-	return host_proc
+	return strings.TrimRight(string(b), "\x00")
 }
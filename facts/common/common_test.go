@@ -2,9 +2,15 @@ package common
 
 import (
 	"fmt"
+	"io/ioutil"
+	"net"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/lzap/ufacter/lib/ufacter"
 )
 
 type netmaskTPair struct {
@@ -153,9 +159,11 @@ func TestIPMaskToString4(t *testing.T) {
 
 func TestIPMaskToString6(t *testing.T) {
 	testpairs := []netmaskBPair{
-		{[]byte{255, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, "ff0::", nil},
+		{[]byte{255, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, "ff00::", nil},
 		{[]byte{255, 255, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, "ffff::", nil},
-		{[]byte{255, 255, 255, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, "ffff:ff0::", nil},
+		{[]byte{255, 255, 255, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, "ffff:ff00::", nil},
+		{[]byte{255, 255, 255, 255, 255, 255, 255, 255, 0, 0, 0, 0, 0, 0, 0, 0}, "ffff:ffff:ffff:ffff::", nil},
+		{[]byte{255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255, 255}, "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", nil},
 	}
 	for _, pair := range testpairs {
 		out := IPMaskToString6(pair.in)
@@ -165,6 +173,30 @@ func TestIPMaskToString6(t *testing.T) {
 	}
 }
 
+type bindingTPair struct {
+	cidr     string
+	extended bool
+	expected map[string]string
+}
+
+func TestBinding(t *testing.T) {
+	testpairs := []bindingTPair{
+		{"192.0.2.10/24", false, map[string]string{"address": "192.0.2.10", "network": "192.0.2.0", "netmask": "255.255.255.0"}},
+		{"2001:db8::10/48", true, map[string]string{"cidr": "2001:db8::10/48", "address": "2001:db8::10", "network": "2001:db8::", "netmask": "ffff:ffff:ffff::"}},
+	}
+	for _, pair := range testpairs {
+		ip, ipnet, err := net.ParseCIDR(pair.cidr)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		ipnet.IP = ip
+		out := Binding(ipnet, pair.extended)
+		if !reflect.DeepEqual(out, pair.expected) {
+			t.Fatalf("%v != %v", out, pair.expected)
+		}
+	}
+}
+
 func TestGetHostEtc(t *testing.T) {
 	testValue := "test_value"
 	err := os.Setenv("HOST_ETC", testValue)
@@ -236,3 +268,152 @@ func TestGetHostSysNotSet(t *testing.T) {
 		t.Fatalf("%v != %v", value, expectedVal)
 	}
 }
+
+func TestGetHostVar(t *testing.T) {
+	testValue := "test_value"
+	err := os.Setenv("HOST_VAR", testValue)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	value := GetHostVar()
+	if strings.Compare(value, testValue) != 0 {
+		t.Fatalf("%v != %v", value, testValue)
+	}
+}
+
+func TestGetHostVarNotSet(t *testing.T) {
+	expectedVal := "/var"
+	err := os.Unsetenv("HOST_VAR")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	value := GetHostVar()
+	if strings.Compare(value, expectedVal) != 0 {
+		t.Fatalf("%v != %v", value, expectedVal)
+	}
+}
+
+func TestGetHostRun(t *testing.T) {
+	testValue := "test_value"
+	err := os.Setenv("HOST_RUN", testValue)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	value := GetHostRun()
+	if strings.Compare(value, testValue) != 0 {
+		t.Fatalf("%v != %v", value, testValue)
+	}
+}
+
+func TestGetHostRunNotSet(t *testing.T) {
+	expectedVal := "/run"
+	err := os.Unsetenv("HOST_RUN")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	value := GetHostRun()
+	if strings.Compare(value, expectedVal) != 0 {
+		t.Fatalf("%v != %v", value, expectedVal)
+	}
+}
+
+func TestGetHostRoot(t *testing.T) {
+	testValue := "test_value"
+	err := os.Setenv("HOST_ROOT", testValue)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	value := GetHostRoot()
+	if strings.Compare(value, testValue) != 0 {
+		t.Fatalf("%v != %v", value, testValue)
+	}
+}
+
+func TestGetHostRootNotSet(t *testing.T) {
+	expectedVal := "/"
+	err := os.Unsetenv("HOST_ROOT")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	value := GetHostRoot()
+	if strings.Compare(value, expectedVal) != 0 {
+		t.Fatalf("%v != %v", value, expectedVal)
+	}
+}
+
+func TestSetHostRoot(t *testing.T) {
+	root, err := ioutil.TempDir("", "ufacter")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(root)
+	defer ResetHostRoot()
+	kernel := filepath.Join(root, "proc", "sys", "kernel")
+	if err := os.MkdirAll(kernel, 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatalf("%v", err)
+	}
+	for name, content := range map[string]string{
+		"proc/sys/kernel/osrelease": "5.14.0-70.el9.x86_64\n",
+		"proc/sys/kernel/arch":      "x86_64\n",
+		"etc/hostname":              "web01.example.com\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	if err := SetHostRoot(filepath.Join(root, "missing")); err == nil || Offline() {
+		t.Fatalf("expected error for missing root")
+	}
+	if err := SetHostRoot(root); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if GetHostEtc() != filepath.Join(root, "etc") || GetHostProc() != filepath.Join(root, "proc") || GetHostRoot() != root {
+		t.Fatalf("unexpected paths %v %v %v", GetHostEtc(), GetHostProc(), GetHostRoot())
+	}
+	if path := HostPath("usr", "lib"); path != filepath.Join(root, "usr", "lib") {
+		t.Fatalf("%v != %v", path, filepath.Join(root, "usr", "lib"))
+	}
+	hostname, err := Hostname()
+	if err != nil || hostname != "web01.example.com" {
+		t.Fatalf("%v != web01.example.com (%v)", hostname, err)
+	}
+	release, machine, err := Uname()
+	if err != nil || release != "5.14.0-70.el9.x86_64" || machine != "x86_64" {
+		t.Fatalf("unexpected uname %v %v (%v)", release, machine, err)
+	}
+
+	facts := make(chan ufacter.Fact, 1)
+	if !SkipOffline(facts, "link") {
+		t.Fatalf("link not skipped offline")
+	}
+	if f := <-facts; f.NameDots() != "ufacter.unavailable.link" {
+		t.Fatalf("unexpected fact %v", f.NameDots())
+	}
+}
+
+type hostPathTPair struct {
+	in  []string
+	out string
+}
+
+func TestHostPath(t *testing.T) {
+	os.Setenv("HOST_ROOT", "/mnt")
+	os.Setenv("HOST_SYS", "/tmp/sys")
+	defer os.Unsetenv("HOST_ROOT")
+	defer os.Unsetenv("HOST_SYS")
+	tests := []hostPathTPair{
+		{[]string{"sys", "class", "net"}, "/tmp/sys/class/net"},
+		{[]string{"etc", "hostname"}, "/etc/hostname"},
+		{[]string{"usr", "lib", "os-release"}, "/mnt/usr/lib/os-release"},
+		{[]string{}, "/mnt"},
+	}
+	for _, pair := range tests {
+		if out := HostPath(pair.in...); out != pair.out {
+			t.Fatalf("%v != %v", out, pair.out)
+		}
+	}
+}
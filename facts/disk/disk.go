@@ -102,6 +102,13 @@ func reportHumanReadable(facts chan<- ufacter.Fact, volatile bool, value uint64,
 	return nil
 }
 
+// reportPartition reports device, filesystem and mount options of partition
+func reportPartition(facts chan<- ufacter.Fact, part d.PartitionStat) {
+	facts <- ufacter.NewStableFact(part.Device, "partitions", part.Device, "device")
+	facts <- ufacter.NewStableFact(part.Fstype, "partitions", part.Device, "filesystem")
+	facts <- ufacter.NewStableFact(strings.Split(part.Opts, ","), "partitions", part.Device, "options")
+}
+
 // ReportFacts returns related to HDDs
 func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
 	start := time.Now()
@@ -110,11 +117,14 @@ func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
 	partitions, err := d.Partitions(false)
 	if err == nil {
 		for _, part := range partitions {
+			if c.Offline() {
+				// mountpoints are not mounted on this system, usage is unknown
+				reportPartition(facts, part)
+				continue
+			}
 			usage, err := d.Usage(part.Mountpoint)
 			if err == nil {
-				facts <- ufacter.NewStableFact(part.Device, "partitions", part.Device, "device")
-				facts <- ufacter.NewStableFact(part.Fstype, "partitions", part.Device, "filesystem")
-				facts <- ufacter.NewStableFact(strings.Split(part.Opts, ","), "partitions", part.Device, "options")
+				reportPartition(facts, part)
 				facts <- ufacter.NewVolatileFact(fmt.Sprintf("%.2f%%", usage.UsedPercent), "partitions", part.Device, "capacity")
 				facts <- ufacter.NewStableFact(usage.Total, "partitions", part.Device, "size_bytes")
 				facts <- ufacter.NewStableFact(c.ConvertBytesAsString(usage.Total), "partitions", part.Device, "size")
@@ -0,0 +1,236 @@
+package dns
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	c "github.com/lzap/ufacter/facts/common"
+	"github.com/lzap/ufacter/lib/ufacter"
+)
+
+// resolvedStubs are local addresses of systemd-resolved stub listeners
+var resolvedStubs = []string{"127.0.0.53", "127.0.0.54"}
+
+// resolvConf is parsed resolv.conf, domain and search override each other
+// and the last one wins as in glibc
+type resolvConf struct {
+	nameservers []string
+	search      []string
+	domain      string
+	sortlist    []string
+	options     map[string]interface{}
+}
+
+// hostEntry is a line from hosts file
+type hostEntry struct {
+	address string
+	names   []string
+}
+
+// fields returns whitespace separated fields of configuration line with
+// comments removed
+func fields(line string, comments string) []string {
+	if i := strings.IndexAny(line, comments); i >= 0 {
+		line = line[:i]
+	}
+	return strings.Fields(line)
+}
+
+func parseResolvConf(filename string) (*resolvConf, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	result := &resolvConf{
+		nameservers: []string{},
+		search:      []string{},
+		sortlist:    []string{},
+		options:     make(map[string]interface{}),
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		f := fields(scanner.Text(), "#;")
+		if len(f) < 2 {
+			continue
+		}
+		switch f[0] {
+		case "nameserver":
+			result.nameservers = append(result.nameservers, f[1])
+		case "domain":
+			result.domain = f[1]
+			result.search = []string{f[1]}
+		case "search":
+			result.domain = ""
+			result.search = f[1:]
+		case "sortlist":
+			result.sortlist = f[1:]
+		case "options":
+			for _, option := range f[1:] {
+				split := strings.SplitN(option, ":", 2)
+				if len(split) == 1 {
+					result.options[option] = true
+				} else if value, err := strconv.ParseInt(split[1], 10, 64); err == nil {
+					result.options[split[0]] = value
+				} else {
+					result.options[split[0]] = split[1]
+				}
+			}
+		}
+	}
+	return result, scanner.Err()
+}
+
+// resolverDomain returns domain or the first search domain as facter does
+func (r *resolvConf) resolverDomain() string {
+	if r.domain != "" {
+		return r.domain
+	}
+	if len(r.search) > 0 {
+		return r.search[0]
+	}
+	return ""
+}
+
+// usesStub returns true when the only nameservers are resolved stubs
+func (r *resolvConf) usesStub() bool {
+	if len(r.nameservers) == 0 {
+		return false
+	}
+	for _, ns := range r.nameservers {
+		stub := false
+		for _, addr := range resolvedStubs {
+			stub = stub || ns == addr
+		}
+		if !stub {
+			return false
+		}
+	}
+	return true
+}
+
+// parseNsswitch returns sources with actions of a database
+func parseNsswitch(filename string, database string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		f := fields(scanner.Text(), "#")
+		if len(f) < 1 || !strings.HasSuffix(f[0], ":") {
+			continue
+		}
+		if strings.TrimSuffix(f[0], ":") == database {
+			return f[1:], scanner.Err()
+		}
+	}
+	return []string{}, scanner.Err()
+}
+
+// parseHosts returns hosts file entries having any of names
+func parseHosts(filename string, names []string) ([]hostEntry, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	result := []hostEntry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		f := fields(scanner.Text(), "#")
+		if len(f) < 2 {
+			continue
+		}
+		match := false
+		for _, name := range f[1:] {
+			for _, wanted := range names {
+				match = match || strings.EqualFold(name, wanted)
+			}
+		}
+		if match {
+			result = append(result, hostEntry{address: f[0], names: f[1:]})
+		}
+	}
+	return result, scanner.Err()
+}
+
+// Domain returns resolver domain from resolv.conf or empty string
+func Domain() string {
+	conf, err := parseResolvConf(c.HostPath("etc", "resolv.conf"))
+	if err != nil {
+		return ""
+	}
+	return conf.resolverDomain()
+}
+
+func reportResolvConf(facts chan<- ufacter.Fact, conf *resolvConf, keys ...string) {
+	facts <- ufacter.NewStableFactEx(conf.nameservers, append(keys, "nameservers")...)
+	facts <- ufacter.NewStableFactEx(conf.search, append(keys, "search")...)
+	facts <- ufacter.NewStableFactEx(conf.resolverDomain(), append(keys, "domain")...)
+	if len(conf.sortlist) > 0 {
+		facts <- ufacter.NewStableFactEx(conf.sortlist, append(keys, "sortlist")...)
+	}
+	if len(conf.options) > 0 {
+		facts <- ufacter.NewStableFactEx(conf.options, append(keys, "options")...)
+	}
+}
+
+// ReportFacts reports resolver configuration, nsswitch hosts order and hosts
+// file entries of this host
+func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
+	start := time.Now()
+	defer ufacter.SendLastFact(facts)
+
+	conf, err := parseResolvConf(c.HostPath("etc", "resolv.conf"))
+	if err == nil {
+		reportResolvConf(facts, conf, "dns")
+		facts <- ufacter.NewStableFactEx(conf.usesStub(), "dns", "resolved", "stub")
+	} else if !os.IsNotExist(err) {
+		c.LogError(facts, err, "dns", "resolv.conf")
+	}
+
+	// upstream servers when systemd-resolved is running
+	upstream, err := parseResolvConf(c.HostPath("run", "systemd", "resolve", "resolv.conf"))
+	if err == nil {
+		reportResolvConf(facts, upstream, "dns", "resolved")
+	} else if !os.IsNotExist(err) {
+		c.LogError(facts, err, "dns", "resolved")
+	}
+
+	sources, err := parseNsswitch(c.HostPath("etc", "nsswitch.conf"), "hosts")
+	if err == nil {
+		facts <- ufacter.NewStableFactEx(sources, "dns", "nsswitch", "hosts")
+	} else if !os.IsNotExist(err) {
+		c.LogError(facts, err, "dns", "nsswitch.conf")
+	}
+
+	names := []string{}
+	if hostname, err := c.Hostname(); err == nil {
+		names = append(names, hostname)
+		if split := strings.SplitN(hostname, ".", 2); len(split) > 1 {
+			names = append(names, split[0])
+		} else if conf != nil && conf.resolverDomain() != "" {
+			names = append(names, hostname+"."+conf.resolverDomain())
+		}
+	}
+	entries, err := parseHosts(c.HostPath("etc", "hosts"), names)
+	if err == nil {
+		list := []map[string]interface{}{}
+		for _, e := range entries {
+			list = append(list, map[string]interface{}{"address": e.address, "names": e.names})
+		}
+		facts <- ufacter.NewStableFactEx(list, "dns", "hosts")
+	} else if !os.IsNotExist(err) {
+		c.LogError(facts, err, "dns", "hosts")
+	}
+
+	ufacter.SendVolatileFactEx(facts, time.Since(start), "ufacter", "stats", "dns")
+}
@@ -0,0 +1,62 @@
+package dns
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseResolvConf(t *testing.T) {
+	result, err := parseResolvConf(filepath.Join("testdata", "etc", "resolv.conf"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := &resolvConf{
+		nameservers: []string{"127.0.0.53"},
+		search:      []string{"example.com", "lab.example.com"},
+		sortlist:    []string{},
+		options:     map[string]interface{}{"edns0": true, "trust-ad": true, "ndots": int64(2)},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+	if result.resolverDomain() != "example.com" || !result.usesStub() {
+		t.Fatalf("unexpected domain %v or stub %v", result.resolverDomain(), result.usesStub())
+	}
+}
+
+func TestParseResolvConfUpstream(t *testing.T) {
+	result, err := parseResolvConf(filepath.Join("testdata", "run", "systemd", "resolve", "resolv.conf"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := []string{"192.0.2.53", "2001:db8::53"}
+	if !reflect.DeepEqual(result.nameservers, expected) {
+		t.Fatalf("%v != %v", result.nameservers, expected)
+	}
+	if result.usesStub() {
+		t.Fatalf("upstream must not be a stub")
+	}
+}
+
+func TestParseNsswitch(t *testing.T) {
+	result, err := parseNsswitch(filepath.Join("testdata", "etc", "nsswitch.conf"), "hosts")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := []string{"files", "myhostname", "resolve", "[!UNAVAIL=return]", "dns"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+}
+
+func TestParseHosts(t *testing.T) {
+	result, err := parseHosts(filepath.Join("testdata", "etc", "hosts"), []string{"WEB01"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := []hostEntry{{"192.0.2.10", []string{"web01.example.com", "web01"}}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+}
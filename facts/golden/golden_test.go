@@ -0,0 +1,210 @@
+package golden
+
+import (
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lzap/ufacter/facts/accounts"
+	c "github.com/lzap/ufacter/facts/common"
+	"github.com/lzap/ufacter/facts/cpu"
+	"github.com/lzap/ufacter/facts/disk"
+	"github.com/lzap/ufacter/facts/dns"
+	"github.com/lzap/ufacter/facts/host"
+	"github.com/lzap/ufacter/facts/kernel"
+	"github.com/lzap/ufacter/facts/load"
+	"github.com/lzap/ufacter/facts/mem"
+	"github.com/lzap/ufacter/facts/packages"
+	"github.com/lzap/ufacter/facts/ssh"
+	"github.com/lzap/ufacter/lib/ufacter"
+)
+
+var update = flag.Bool("update", false, "Write golden files from facts reported by fixture trees")
+
+// reporters which read only files, modules which need the running system
+// report themselves unavailable offline
+var reporters = map[string]ufacter.Reporter{
+	"accounts": accounts.ReportFacts,
+	"cpu":      cpu.ReportFacts,
+	"disk":     disk.ReportFacts,
+	"dns":      dns.ReportFacts,
+	"host":     host.ReportFacts,
+	"kernel":   kernel.ReportFacts,
+	"load":     load.ReportFacts,
+	"mem":      mem.ReportFacts,
+	"packages": packages.ReportFacts,
+	"ssh":      ssh.ReportFacts,
+}
+
+// nondeterministic facts depend on the time of collection
+var nondeterministic = []string{
+	"ufacter.stats",
+	"system_uptime.seconds",
+	"system_uptime.hours",
+	"system_uptime.days",
+	"system_uptime.uptime",
+}
+
+func skipped(name string) bool {
+	for _, prefix := range nondeterministic {
+		if name == prefix || strings.HasPrefix(name, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// render returns facts in JSON format, errors are strings with fixture root
+// path replaced so golden files do not depend on checkout location
+func render(facts []ufacter.Fact, root string) string {
+	formatter := ufacter.NewJSONFormatter()
+	for _, f := range facts {
+		if skipped(f.NameDots()) {
+			continue
+		}
+		if err, ok := f.Value.(error); ok {
+			f.Value = strings.Replace(err.Error(), root, "$ROOT", -1)
+		}
+		formatter.Add(f)
+	}
+	return formatter.IntentJSONString()
+}
+
+// flattenJSON returns facts from rendered JSON by name in dot format
+func flattenJSON(t *testing.T, filename string, data string) map[string]interface{} {
+	if err := ioutil.WriteFile(filename, []byte(data), 0600); err != nil {
+		t.Fatalf("%v", err)
+	}
+	result, err := ufacter.LoadSnapshot(filename)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return result
+}
+
+func TestGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "*", "root"))
+	if err != nil || len(fixtures) == 0 {
+		t.Fatalf("no fixtures found: %v", err)
+	}
+	tmp, err := ioutil.TempDir("", "ufacter")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(tmp)
+	defer c.ResetHostRoot()
+
+	names := make([]string, 0, len(reporters))
+	for name := range reporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, fixture := range fixtures {
+		dir := filepath.Dir(fixture)
+		if err := c.SetHostRoot(fixture); err != nil {
+			t.Fatalf("%v", err)
+		}
+		root := c.GetHostRoot()
+		for _, name := range names {
+			t.Run(filepath.Base(dir)+"/"+name, func(t *testing.T) {
+				facts := ufacter.Collect([]ufacter.Reporter{reporters[name]}, true, true)
+				for _, f := range facts {
+					if f.Volatile && !ufacter.IsVolatilePath(f.NameDots()) {
+						t.Errorf("volatile fact %s is missing in ufacter.VolatilePaths", f.NameDots())
+					}
+				}
+				actual := render(facts, root)
+				golden := filepath.Join(dir, "golden", name+".json")
+				if *update {
+					if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+						t.Fatalf("%v", err)
+					}
+					if err := ioutil.WriteFile(golden, []byte(actual), 0644); err != nil {
+						t.Fatalf("%v", err)
+					}
+					return
+				}
+				expected, err := ioutil.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("%v (run go test with -update to create golden files)", err)
+				}
+				if actual == string(expected) {
+					return
+				}
+				changes := ufacter.Diff(
+					flattenJSON(t, filepath.Join(tmp, "expected.json"), string(expected)),
+					flattenJSON(t, filepath.Join(tmp, "actual.json"), actual))
+				for _, change := range changes {
+					t.Errorf("%s %s: %v => %v", change.Kind, change.Name, change.Old, change.New)
+				}
+				if len(changes) == 0 {
+					t.Errorf("%s differs in formatting", golden)
+				}
+			})
+		}
+	}
+}
+
+// volatileCalls are constructors of volatile facts with index of the first key
+var volatileCalls = map[string]int{
+	"NewVolatileFact":    1,
+	"NewVolatileFactEx":  1,
+	"SendVolatileFactEx": 2,
+}
+
+// TestVolatilePaths checks that names of volatile facts created by volatile
+// constructors in all reporters, including those which cannot run offline,
+// are in ufacter.VolatilePaths; keys which are not string literals match any
+// name, facts with computed volatile flag are checked by TestGolden
+func TestVolatilePaths(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "*", "*.go"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	fset := token.NewFileSet()
+	for _, filename := range files {
+		if strings.HasSuffix(filename, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, filename, nil, 0)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		ast.Inspect(file, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			first, ok := volatileCalls[sel.Sel.Name]
+			if !ok || len(call.Args) <= first {
+				return true
+			}
+			keys := []string{}
+			for _, arg := range call.Args[first:] {
+				key := "any"
+				if lit, ok := arg.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					key, _ = strconv.Unquote(lit.Value)
+				}
+				keys = append(keys, key)
+			}
+			name := strings.Join(keys, ".")
+			if !ufacter.IsVolatilePath(name) {
+				t.Errorf("%s: volatile fact %s is missing in ufacter.VolatilePaths", fset.Position(call.Pos()), name)
+			}
+			return true
+		})
+	}
+}
@@ -2,12 +2,15 @@ package host
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
-	"syscall"
 	"time"
 
 	c "github.com/lzap/ufacter/facts/common"
+	"github.com/lzap/ufacter/facts/dns"
+	"github.com/lzap/ufacter/facts/virtual"
 	"github.com/lzap/ufacter/lib/ufacter"
 	h "github.com/shirou/gopsutil/host"
 )
@@ -22,17 +25,23 @@ func capitalize(label string) string {
 		strings.TrimPrefix(label, firstLetter[0]))
 }
 
-// int8ToString converts [65]int8 in syscall.Utsname to string
-func int8ToString(bs [65]int8) string {
-	b := make([]byte, len(bs))
-	for i, v := range bs {
-		if v < 0 {
-			b[i] = byte(256 + int(v))
-		} else {
-			b[i] = byte(v)
-		}
+// offlineTimezone returns current time zone abbreviation of etc/localtime,
+// absolute symlinks are resolved within host root
+func offlineTimezone() string {
+	localtime := c.HostPath("etc", "localtime")
+	if target, err := os.Readlink(localtime); err == nil && filepath.IsAbs(target) {
+		localtime = c.HostPath(target)
 	}
-	return strings.TrimRight(string(b), "\x00")
+	data, err := ioutil.ReadFile(localtime)
+	if err != nil {
+		return ""
+	}
+	loc, err := time.LoadLocationFromTZData("", data)
+	if err != nil {
+		return ""
+	}
+	tz, _ := time.Now().In(loc).Zone()
+	return tz
 }
 
 // ReportFacts gathers facts related to host information
@@ -41,11 +50,14 @@ func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
 	defer ufacter.SendLastFact(facts)
 
 	envPath := os.Getenv("PATH")
-	if envPath != "" {
+	if envPath != "" && !c.Offline() {
 		facts <- ufacter.NewStableFact(envPath, "path")
 	}
 
 	tz, _ := time.Now().Zone()
+	if c.Offline() {
+		tz = offlineTimezone()
+	}
 	facts <- ufacter.NewStableFact(tz, "timezone")
 
 	hostInfo, err := h.Info()
@@ -54,43 +66,46 @@ func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
 		facts <- ufacter.NewLastFact()
 		return
 	}
+	// gopsutil queries the running system for these
+	if hostInfo.Hostname, err = c.Hostname(); err != nil {
+		c.LogError(facts, err, "host", "hostname")
+	}
+	kernelRelease, machine, unameErr := c.Uname()
+	hostInfo.KernelArch = machine
 
-	facts <- ufacter.NewStableFact(hostInfo.Hostname, "networking", "fqdn")
 	splitted := strings.SplitN(hostInfo.Hostname, ".", 2)
 	var hostname *string
 	if len(splitted) > 1 {
 		hostname = &splitted[0]
+		facts <- ufacter.NewStableFact(hostInfo.Hostname, "networking", "fqdn")
 		facts <- ufacter.NewStableFact(splitted[1], "networking", "domain")
+	} else if domain := dns.Domain(); domain != "" {
+		// short hostname, domain from resolver as facter does
+		hostname = &hostInfo.Hostname
+		facts <- ufacter.NewStableFact(hostInfo.Hostname+"."+domain, "networking", "fqdn")
+		facts <- ufacter.NewStableFact(domain, "networking", "domain")
 	} else {
 		hostname = &hostInfo.Hostname
+		facts <- ufacter.NewStableFact(hostInfo.Hostname, "networking", "fqdn")
 	}
 	facts <- ufacter.NewStableFact(*hostname, "networking", "hostname")
 
-	var isVirtual bool
-	if hostInfo.VirtualizationRole == "host" {
-		isVirtual = false
-	} else {
-		isVirtual = true
-	}
-	facts <- ufacter.NewStableFact(isVirtual, "is_virtual")
-	if hostInfo.VirtualizationRole == "host" {
-		facts <- ufacter.NewStableFact("physical", "virtual")
-	} else {
-		facts <- ufacter.NewStableFact(hostInfo.VirtualizationSystem, "virtual")
-	}
+	virt := virtual.NewDetector().Detect()
+	facts <- ufacter.NewStableFact(virt.IsVirtual(), "is_virtual")
+	facts <- ufacter.NewStableFact(virt.Virtual(), "virtual")
+	facts <- ufacter.NewStableFactEx(virt.Hypervisor, "virtualization", "hypervisor")
+	facts <- ufacter.NewStableFactEx(virt.Container, "virtualization", "container")
+	facts <- ufacter.NewStableFactEx(virt.Nested(), "virtualization", "nested")
 
 	facts <- ufacter.NewStableFact(capitalize(hostInfo.OS), "kernel")
-	var uname syscall.Utsname
-	err = syscall.Uname(&uname)
-	if err == nil {
-		kernelRelease := int8ToString(uname.Release)
+	if unameErr == nil {
 		kernelVersion := strings.Split(kernelRelease, "-")[0]
 		kvSplitted := strings.Split(kernelVersion, ".")
 		facts <- ufacter.NewStableFact(kernelRelease, "kernelrelease")
 		facts <- ufacter.NewStableFact(kernelVersion, "kernelversion")
 		facts <- ufacter.NewStableFact(strings.Join(kvSplitted[0:2], "."), "kernelmajversion")
 	} else {
-		c.LogError(facts, err, "host", "uname")
+		c.LogError(facts, unameErr, "host", "uname")
 	}
 
 	// report architecture into the processor tree as well
@@ -0,0 +1,264 @@
+package kernel
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	c "github.com/lzap/ufacter/facts/common"
+	"github.com/lzap/ufacter/lib/ufacter"
+)
+
+// DefaultSysctls are sysctl keys commonly audited by hardening baselines
+var DefaultSysctls = []string{
+	"fs.protected_hardlinks",
+	"fs.protected_symlinks",
+	"fs.suid_dumpable",
+	"kernel.dmesg_restrict",
+	"kernel.kexec_load_disabled",
+	"kernel.kptr_restrict",
+	"kernel.panic",
+	"kernel.randomize_va_space",
+	"kernel.sysrq",
+	"kernel.unprivileged_bpf_disabled",
+	"kernel.yama.ptrace_scope",
+	"net.ipv4.conf.all.accept_redirects",
+	"net.ipv4.conf.all.accept_source_route",
+	"net.ipv4.conf.all.rp_filter",
+	"net.ipv4.conf.all.send_redirects",
+	"net.ipv4.icmp_echo_ignore_broadcasts",
+	"net.ipv4.ip_forward",
+	"net.ipv4.tcp_syncookies",
+	"net.ipv6.conf.all.accept_redirects",
+	"net.ipv6.conf.all.forwarding",
+	"vm.swappiness",
+}
+
+// Sysctls is the allowlist of reported sysctl keys
+var Sysctls = DefaultSysctls
+
+// taintFlags maps bits of /proc/sys/kernel/tainted to names, see
+// Documentation/admin-guide/tainted-kernels.rst
+var taintFlags = []string{
+	"proprietary_module",
+	"forced_module",
+	"cpu_out_of_spec",
+	"forced_rmmod",
+	"machine_check",
+	"bad_page",
+	"user",
+	"die",
+	"overridden_acpi_table",
+	"warn",
+	"staging_driver",
+	"firmware_workaround",
+	"oot_module",
+	"unsigned_module",
+	"soft_lockup",
+	"livepatch",
+	"auxiliary",
+	"randstruct",
+	"test",
+}
+
+// module represents a loaded kernel module from /proc/modules
+type module struct {
+	name     string
+	size     uint64
+	refcount int64
+	usedBy   []string
+	state    string
+}
+
+// splitCmdline splits kernel command line into parameters honouring double
+// quotes, arguments after "--" are passed to init and ignored
+func splitCmdline(cmdline string) []string {
+	result := []string{}
+	current := strings.Builder{}
+	quoted := false
+	for _, r := range strings.TrimSpace(cmdline) {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case (r == ' ' || r == '\t' || r == '\n') && !quoted:
+			if current.Len() > 0 {
+				result = append(result, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		result = append(result, current.String())
+	}
+	for i, param := range result {
+		if param == "--" {
+			return result[:i]
+		}
+	}
+	return result
+}
+
+// parseCmdline parses kernel command line into key/value pairs, parameters
+// without value are true and repeated parameters become a list
+func parseCmdline(cmdline string) map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, param := range splitCmdline(cmdline) {
+		var value interface{} = true
+		key := param
+		if idx := strings.Index(param, "="); idx > 0 {
+			key = param[:idx]
+			value = param[idx+1:]
+		}
+		switch existing := result[key].(type) {
+		case nil:
+			result[key] = value
+		case []interface{}:
+			result[key] = append(existing, value)
+		default:
+			result[key] = []interface{}{existing, value}
+		}
+	}
+	return result
+}
+
+// parseModules parses /proc/modules
+func parseModules(filename string) ([]module, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	result := []module{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// name size refcount used_by state address
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		m := module{name: fields[0], state: strings.ToLower(fields[4]), usedBy: []string{}}
+		m.size, _ = strconv.ParseUint(fields[1], 10, 64)
+		m.refcount, _ = strconv.ParseInt(fields[2], 10, 64)
+		for _, dep := range strings.Split(fields[3], ",") {
+			if dep != "" && dep != "-" {
+				m.usedBy = append(m.usedBy, dep)
+			}
+		}
+		result = append(result, m)
+	}
+	return result, scanner.Err()
+}
+
+// decodeTaint returns names of taint flags set in value, unknown bits are
+// reported as "bit_N"
+func decodeTaint(value uint64) []string {
+	result := []string{}
+	for bit := uint(0); bit < 64; bit++ {
+		if value&(1<<bit) == 0 {
+			continue
+		}
+		if int(bit) < len(taintFlags) {
+			result = append(result, taintFlags[bit])
+		} else {
+			result = append(result, "bit_"+strconv.Itoa(int(bit)))
+		}
+	}
+	return result
+}
+
+// sysctlPath converts sysctl key to path relative to /proc/sys, dots are
+// separators and slashes stand for dots in names (e.g. VLAN interfaces)
+func sysctlPath(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.':
+			return '/'
+		case '/':
+			return '.'
+		}
+		return r
+	}, key)
+}
+
+// readSysctl reads sysctl value, numbers are returned as int64 and multiple
+// values are separated by a single space
+func readSysctl(procSys string, key string) (interface{}, error) {
+	content, err := c.ReadFileString(filepath.Join(procSys, sysctlPath(key)))
+	if err != nil {
+		return nil, err
+	}
+	value := strings.Join(strings.Fields(content), " ")
+	if number, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return number, nil
+	}
+	return value, nil
+}
+
+// ReportFacts gathers kernel command line, loaded modules, taint state and
+// sysctl values
+func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
+	start := time.Now()
+	defer ufacter.SendLastFact(facts)
+	proc := c.GetHostProc()
+
+	cmdline, err := c.ReadFileString(filepath.Join(proc, "cmdline"))
+	if err == nil {
+		facts <- ufacter.NewStableFactEx(cmdline, "kernelcmdline", "raw")
+		for key, value := range parseCmdline(cmdline) {
+			facts <- ufacter.NewStableFactEx(value, "kernelcmdline", "parameters", key)
+		}
+	} else {
+		c.LogError(facts, err, "kernel", "cmdline")
+	}
+
+	modules, err := parseModules(filepath.Join(proc, "modules"))
+	if err == nil {
+		for _, m := range modules {
+			facts <- ufacter.NewStableFactEx(m.size, "kernelmodules", m.name, "size")
+			facts <- ufacter.NewStableFactEx(m.state, "kernelmodules", m.name, "state")
+			facts <- ufacter.NewStableFactEx(m.usedBy, "kernelmodules", m.name, "used_by")
+			if volatile {
+				facts <- ufacter.NewVolatileFactEx(m.refcount, "kernelmodules", m.name, "refcount")
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		// kernels without module support have no /proc/modules
+		c.LogError(facts, err, "kernel", "modules")
+	}
+
+	procSys := filepath.Join(proc, "sys")
+	tainted, err := c.ReadFileString(filepath.Join(procSys, "kernel", "tainted"))
+	if err == nil {
+		value, err := strconv.ParseUint(tainted, 10, 64)
+		if err == nil {
+			facts <- ufacter.NewStableFactEx(value, "kerneltainted", "value")
+			facts <- ufacter.NewStableFactEx(value != 0, "kerneltainted", "tainted")
+			facts <- ufacter.NewStableFactEx(decodeTaint(value), "kerneltainted", "flags")
+		} else {
+			c.LogError(facts, err, "kernel", "tainted")
+		}
+	} else {
+		c.LogError(facts, err, "kernel", "tainted")
+	}
+
+	for _, key := range Sysctls {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		value, err := readSysctl(procSys, key)
+		if err == nil {
+			facts <- ufacter.NewStableFactEx(value, "sysctl", key)
+		} else if !os.IsNotExist(err) {
+			c.LogError(facts, err, "kernel", "sysctl", key)
+		}
+	}
+
+	ufacter.SendVolatileFactEx(facts, time.Since(start), "ufacter", "stats", "kernel")
+}
@@ -0,0 +1,92 @@
+package kernel
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	c "github.com/lzap/ufacter/facts/common"
+)
+
+func TestParseCmdline(t *testing.T) {
+	cmdline, err := c.ReadFileString(filepath.Join("testdata", "proc", "cmdline"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	result := parseCmdline(cmdline)
+	expected := map[string]interface{}{
+		"BOOT_IMAGE":  "(hd0,gpt2)/vmlinuz-5.14.0",
+		"root":        "/dev/mapper/rhel-root",
+		"ro":          true,
+		"crashkernel": "1G-4G:192M",
+		"rd.lvm.lv":   "rhel/root",
+		"quiet":       true,
+		"console":     []interface{}{"tty0", "ttyS0,115200"},
+		"dyndbg":      "file drivers/usb/* +p",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+}
+
+func TestParseModules(t *testing.T) {
+	modules, err := parseModules(filepath.Join("testdata", "proc", "modules"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := []module{
+		{"nft_fib_inet", 16384, 1, []string{}, "live"},
+		{"nf_tables", 270336, 218, []string{"nft_fib_inet", "nft_reject_inet", "nft_ct"}, "live"},
+		{"vboxdrv", 565248, 2, []string{}, "live"},
+		{"xfs", 2015232, 0, []string{}, "loading"},
+	}
+	if !reflect.DeepEqual(modules, expected) {
+		t.Fatalf("%v != %v", modules, expected)
+	}
+}
+
+type taintTPair struct {
+	input    uint64
+	expected []string
+}
+
+func TestDecodeTaint(t *testing.T) {
+	tests := []taintTPair{
+		{0, []string{}},
+		{12289, []string{"proprietary_module", "oot_module", "unsigned_module"}},
+		{1 << 40, []string{"bit_40"}},
+	}
+	for _, pair := range tests {
+		result := decodeTaint(pair.input)
+		if !reflect.DeepEqual(result, pair.expected) {
+			t.Fatalf("%v != %v", result, pair.expected)
+		}
+	}
+}
+
+type sysctlTPair struct {
+	key      string
+	expected interface{}
+}
+
+func TestReadSysctl(t *testing.T) {
+	procSys := filepath.Join("testdata", "proc", "sys")
+	tests := []sysctlTPair{
+		{"kernel.randomize_va_space", int64(2)},
+		{"kernel.tainted", int64(12289)},
+		{"kernel.printk", "4 16384 16384"},
+		{"net.ipv4.conf.eth0/100.rp_filter", int64(1)},
+	}
+	for _, pair := range tests {
+		result, err := readSysctl(procSys, pair.key)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if result != pair.expected {
+			t.Fatalf("%v != %v", result, pair.expected)
+		}
+	}
+	if _, err := readSysctl(procSys, "kernel.missing"); err == nil {
+		t.Fatalf("expected error for missing key")
+	}
+}
@@ -0,0 +1,133 @@
+package link
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	c "github.com/lzap/ufacter/facts/common"
+	"github.com/lzap/ufacter/lib/ufacter"
+)
+
+// udevNames maps udev properties of predictable names to fact names
+var udevNames = map[string]string{
+	"ID_NET_NAME_ONBOARD": "onboard",
+	"ID_NET_NAME_SLOT":    "slot",
+	"ID_NET_NAME_PATH":    "path",
+	"ID_NET_NAME_MAC":     "mac",
+}
+
+// readUdevNames returns predictable name candidates from udev database
+func readUdevNames(index int) (map[string]string, error) {
+	f, err := os.Open(c.HostPath("run", "udev", "data", "n"+strconv.Itoa(index)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	result := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "E:") {
+			continue
+		}
+		split := strings.SplitN(line[2:], "=", 2)
+		if len(split) != 2 {
+			continue
+		}
+		if name, ok := udevNames[split[0]]; ok {
+			result[name] = split[1]
+		}
+	}
+	return result, scanner.Err()
+}
+
+// netdevNames returns sorted names of network devices of a sysfs device
+func netdevNames(path string) []string {
+	result := []string{}
+	entries, err := ioutil.ReadDir(filepath.Join(path, "net"))
+	if err != nil {
+		return result
+	}
+	for _, entry := range entries {
+		result = append(result, entry.Name())
+	}
+	sort.Strings(result)
+	return result
+}
+
+// linkBase returns base name of symlink target
+func linkBase(path string) string {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
+
+// reportSriov sends PF and VF relationships of a PCI network device
+func reportSriov(facts chan<- ufacter.Fact, device string, path string) {
+	if total, ok := readSysfsInt(device, "device", "sriov_totalvfs"); ok {
+		facts <- ufacter.NewStableFact(total, "link", device, "sriov", "totalvfs")
+		if num, ok := readSysfsInt(device, "device", "sriov_numvfs"); ok {
+			facts <- ufacter.NewStableFact(num, "link", device, "sriov", "numvfs")
+		}
+		vfs, _ := filepath.Glob(filepath.Join(path, "virtfn*"))
+		list := []map[string]interface{}{}
+		for _, vf := range vfs {
+			index, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(vf), "virtfn"))
+			if err != nil {
+				continue
+			}
+			list = append(list, map[string]interface{}{
+				"index":   index,
+				"pci":     linkBase(vf),
+				"devices": netdevNames(vf),
+			})
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i]["index"].(int) < list[j]["index"].(int) })
+		facts <- ufacter.NewStableFact(list, "link", device, "sriov", "vfs")
+	}
+
+	physfn := filepath.Join(path, "physfn")
+	if pf := linkBase(physfn); pf != "" {
+		facts <- ufacter.NewStableFact(pf, "link", device, "sriov", "pf_pci")
+		if names := netdevNames(physfn); len(names) > 0 {
+			facts <- ufacter.NewStableFact(names[0], "link", device, "sriov", "pf")
+		}
+	}
+}
+
+// reportDevice sends driver, PCI and NUMA details of hardware backed devices
+func reportDevice(facts chan<- ufacter.Fact, device string) {
+	path := c.HostPath("sys", "class", "net", device, "device")
+	if _, err := os.Stat(path); err != nil {
+		// virtual device
+		return
+	}
+	facts <- ufacter.NewStableFact(linkBase(filepath.Join(path, "driver")), "link", device, "driver")
+	if linkBase(filepath.Join(path, "subsystem")) != "pci" {
+		return
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		facts <- ufacter.NewStableFact(filepath.Base(resolved), "link", device, "pci", "address")
+	}
+	for _, attr := range []string{"vendor", "device", "subsystem_vendor", "subsystem_device"} {
+		value, err := c.ReadFileString(filepath.Join(path, attr))
+		if err == nil {
+			facts <- ufacter.NewStableFact(value, "link", device, "pci", attr)
+		}
+	}
+	// NUMA node is -1 on single node systems
+	if node, ok := readSysfsInt(device, "device", "numa_node"); ok && node >= 0 {
+		facts <- ufacter.NewStableFact(node, "link", device, "numa_node")
+	}
+	reportSriov(facts, device, path)
+}
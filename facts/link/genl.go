@@ -0,0 +1,312 @@
+package link
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+
+	n "github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+// nested and byte order flags are not part of attribute type
+const nlaTypeMask = 0x3fff
+
+// WireGuard generic netlink interface, see include/uapi/linux/wireguard.h
+const (
+	wgCmdGetDevice = 0
+
+	wgDeviceIfindex    = 1
+	wgDevicePublicKey  = 4
+	wgDeviceListenPort = 6
+	wgDeviceFwmark     = 7
+	wgDevicePeers      = 8
+
+	wgPeerPublicKey     = 1
+	wgPeerEndpoint      = 4
+	wgPeerKeepalive     = 5
+	wgPeerLastHandshake = 6
+	wgPeerRxBytes       = 7
+	wgPeerTxBytes       = 8
+	wgPeerAllowedIPs    = 9
+
+	wgAllowedIPFamily = 1
+	wgAllowedIPAddr   = 2
+	wgAllowedIPMask   = 3
+)
+
+// team generic netlink interface, see include/uapi/linux/if_team.h
+const (
+	teamCmdOptionsGet = 2
+
+	teamAttrIfindex    = 1
+	teamAttrListOption = 2
+	teamAttrItemOption = 1
+
+	teamOptionName        = 1
+	teamOptionType        = 3
+	teamOptionData        = 4
+	teamOptionPortIfindex = 6
+
+	nlaU32    = 3
+	nlaString = 5
+	nlaFlag   = 6
+)
+
+// wgPeer is a WireGuard peer, private and preshared keys are never read
+type wgPeer struct {
+	publicKey     string
+	endpoint      string
+	allowedIPs    []string
+	keepalive     uint16
+	lastHandshake int64
+	rxBytes       uint64
+	txBytes       uint64
+}
+
+// wgDevice is a WireGuard device configuration
+type wgDevice struct {
+	publicKey  string
+	listenPort uint16
+	fwmark     uint32
+	peers      []wgPeer
+}
+
+// genlRequest sends generic netlink request and returns parsed attributes of
+// all reply messages
+func genlRequest(family string, cmd uint8, flags int, attrs ...*nl.RtAttr) ([][]syscall.NetlinkRouteAttr, error) {
+	f, err := n.GenlFamilyGet(family)
+	if err != nil {
+		return nil, err
+	}
+	req := nl.NewNetlinkRequest(int(f.ID), flags)
+	req.AddData(&nl.Genlmsg{Command: cmd, Version: 1})
+	for _, attr := range attrs {
+		req.AddData(attr)
+	}
+	msgs, err := req.Execute(syscall.NETLINK_GENERIC, 0)
+	if err != nil {
+		return nil, err
+	}
+	result := [][]syscall.NetlinkRouteAttr{}
+	for _, msg := range msgs {
+		if len(msg) < nl.SizeofGenlmsg {
+			continue
+		}
+		parsed, err := nl.ParseRouteAttr(msg[nl.SizeofGenlmsg:])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, parsed)
+	}
+	return result, nil
+}
+
+// parseSockaddr decodes struct sockaddr_in or sockaddr_in6
+func parseSockaddr(b []byte) string {
+	if len(b) < 4 {
+		return ""
+	}
+	port := int(binary.BigEndian.Uint16(b[2:4]))
+	switch nl.NativeEndian().Uint16(b[0:2]) {
+	case syscall.AF_INET:
+		if len(b) >= 8 {
+			return net.JoinHostPort(net.IP(b[4:8]).String(), fmt.Sprint(port))
+		}
+	case syscall.AF_INET6:
+		if len(b) >= 24 {
+			return net.JoinHostPort(net.IP(b[8:24]).String(), fmt.Sprint(port))
+		}
+	}
+	return ""
+}
+
+// encodeKey returns key in base64 as wg(8) shows it
+func encodeKey(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func parseAllowedIPs(b []byte) []string {
+	result := []string{}
+	items, err := nl.ParseRouteAttr(b)
+	if err != nil {
+		return result
+	}
+	for _, item := range items {
+		attrs, err := nl.ParseRouteAttr(item.Value)
+		if err != nil {
+			continue
+		}
+		var ip net.IP
+		mask := -1
+		for _, attr := range attrs {
+			switch attr.Attr.Type & nlaTypeMask {
+			case wgAllowedIPAddr:
+				ip = net.IP(attr.Value)
+			case wgAllowedIPMask:
+				if len(attr.Value) > 0 {
+					mask = int(attr.Value[0])
+				}
+			}
+		}
+		if ip != nil && mask >= 0 {
+			result = append(result, fmt.Sprintf("%s/%d", ip, mask))
+		}
+	}
+	return result
+}
+
+func parseWgPeer(b []byte) wgPeer {
+	peer := wgPeer{allowedIPs: []string{}}
+	attrs, err := nl.ParseRouteAttr(b)
+	if err != nil {
+		return peer
+	}
+	native := nl.NativeEndian()
+	for _, attr := range attrs {
+		switch attr.Attr.Type & nlaTypeMask {
+		case wgPeerPublicKey:
+			peer.publicKey = encodeKey(attr.Value)
+		case wgPeerEndpoint:
+			peer.endpoint = parseSockaddr(attr.Value)
+		case wgPeerKeepalive:
+			if len(attr.Value) >= 2 {
+				peer.keepalive = native.Uint16(attr.Value)
+			}
+		case wgPeerLastHandshake:
+			if len(attr.Value) >= 8 {
+				peer.lastHandshake = int64(native.Uint64(attr.Value))
+			}
+		case wgPeerRxBytes:
+			if len(attr.Value) >= 8 {
+				peer.rxBytes = native.Uint64(attr.Value)
+			}
+		case wgPeerTxBytes:
+			if len(attr.Value) >= 8 {
+				peer.txBytes = native.Uint64(attr.Value)
+			}
+		case wgPeerAllowedIPs:
+			peer.allowedIPs = parseAllowedIPs(attr.Value)
+		}
+	}
+	return peer
+}
+
+// parseWireguard decodes WG_CMD_GET_DEVICE replies, large devices are split
+// into multiple messages with peers continuing in the next message
+func parseWireguard(msgs [][]syscall.NetlinkRouteAttr) *wgDevice {
+	device := &wgDevice{peers: []wgPeer{}}
+	native := nl.NativeEndian()
+	for _, attrs := range msgs {
+		for _, attr := range attrs {
+			switch attr.Attr.Type & nlaTypeMask {
+			case wgDevicePublicKey:
+				device.publicKey = encodeKey(attr.Value)
+			case wgDeviceListenPort:
+				if len(attr.Value) >= 2 {
+					device.listenPort = native.Uint16(attr.Value)
+				}
+			case wgDeviceFwmark:
+				if len(attr.Value) >= 4 {
+					device.fwmark = native.Uint32(attr.Value)
+				}
+			case wgDevicePeers:
+				peers, err := nl.ParseRouteAttr(attr.Value)
+				if err != nil {
+					continue
+				}
+				for _, p := range peers {
+					peer := parseWgPeer(p.Value)
+					last := len(device.peers) - 1
+					if last >= 0 && device.peers[last].publicKey == peer.publicKey {
+						// continuation of allowed IPs from previous message
+						device.peers[last].allowedIPs = append(device.peers[last].allowedIPs, peer.allowedIPs...)
+						continue
+					}
+					device.peers = append(device.peers, peer)
+				}
+			}
+		}
+	}
+	return device
+}
+
+func queryWireguard(index int) (*wgDevice, error) {
+	msgs, err := genlRequest("wireguard", wgCmdGetDevice, syscall.NLM_F_DUMP,
+		nl.NewRtAttr(wgDeviceIfindex, nl.Uint32Attr(uint32(index))))
+	if err != nil {
+		return nil, err
+	}
+	return parseWireguard(msgs), nil
+}
+
+// parseTeamOptions decodes team device options without per-port options,
+// unsigned, string and flag options are supported
+func parseTeamOptions(msgs [][]syscall.NetlinkRouteAttr) map[string]interface{} {
+	result := make(map[string]interface{})
+	native := nl.NativeEndian()
+	for _, attrs := range msgs {
+		for _, attr := range attrs {
+			if attr.Attr.Type&nlaTypeMask != teamAttrListOption {
+				continue
+			}
+			items, err := nl.ParseRouteAttr(attr.Value)
+			if err != nil {
+				continue
+			}
+			for _, item := range items {
+				if item.Attr.Type&nlaTypeMask != teamAttrItemOption {
+					continue
+				}
+				fields, err := nl.ParseRouteAttr(item.Value)
+				if err != nil {
+					continue
+				}
+				var name string
+				var kind uint8
+				var data []byte
+				hasData, perPort := false, false
+				for _, field := range fields {
+					switch field.Attr.Type & nlaTypeMask {
+					case teamOptionName:
+						name = nl.BytesToString(field.Value)
+					case teamOptionType:
+						if len(field.Value) > 0 {
+							kind = field.Value[0]
+						}
+					case teamOptionData:
+						data = field.Value
+						hasData = true
+					case teamOptionPortIfindex:
+						perPort = true
+					}
+				}
+				if name == "" || perPort {
+					continue
+				}
+				switch kind {
+				case nlaU32:
+					if len(data) >= 4 {
+						result[name] = native.Uint32(data)
+					}
+				case nlaString:
+					result[name] = nl.BytesToString(data)
+				case nlaFlag:
+					result[name] = hasData
+				}
+			}
+		}
+	}
+	return result
+}
+
+func queryTeam(index int) (map[string]interface{}, error) {
+	msgs, err := genlRequest("team", teamCmdOptionsGet, 0,
+		nl.NewRtAttr(teamAttrIfindex, nl.Uint32Attr(uint32(index))))
+	if err != nil {
+		return nil, err
+	}
+	return parseTeamOptions(msgs), nil
+}
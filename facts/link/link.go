@@ -1,68 +1,193 @@
 package link
 
 import (
+	"strconv"
 	"time"
 
 	c "github.com/lzap/ufacter/facts/common"
+	"github.com/lzap/ufacter/facts/rtnl"
 	"github.com/lzap/ufacter/lib/ufacter"
 	n "github.com/vishvananda/netlink"
 )
 
-func idToName(id int) string {
-	if id == 0 {
-		return ""
+// handle is replaced by a fake in tests
+var handle = rtnl.Netlink()
+
+// interfaceFlags maps IFF_* bits to names as printed by ip link
+var interfaceFlags = []struct {
+	bit  uint32
+	name string
+}{
+	{0x1, "UP"},
+	{0x2, "BROADCAST"},
+	{0x4, "DEBUG"},
+	{0x8, "LOOPBACK"},
+	{0x10, "POINTOPOINT"},
+	{0x20, "NOTRAILERS"},
+	{0x40, "RUNNING"},
+	{0x80, "NOARP"},
+	{0x100, "PROMISC"},
+	{0x200, "ALLMULTI"},
+	{0x400, "MASTER"},
+	{0x800, "SLAVE"},
+	{0x1000, "MULTICAST"},
+	{0x2000, "PORTSEL"},
+	{0x4000, "AUTOMEDIA"},
+	{0x8000, "DYNAMIC"},
+	{0x10000, "LOWER_UP"},
+	{0x20000, "DORMANT"},
+	{0x40000, "ECHO"},
+}
+
+const (
+	iffPromisc = 0x100
+	iffLowerUp = 0x10000
+)
+
+// flagNames returns names of interface flags set in raw flags
+func flagNames(raw uint32) []string {
+	result := []string{}
+	for _, flag := range interfaceFlags {
+		if raw&flag.bit != 0 {
+			result = append(result, flag.name)
+		}
 	}
+	return result
+}
 
-	link, err := n.LinkByIndex(id)
+// readSpeed returns link speed in Mbps from sysfs, virtual devices and
+// devices without carrier have no speed
+func readSpeed(device string) (int64, bool) {
+	value, err := c.ReadFileString(c.HostPath("sys", "class", "net", device, "speed"))
 	if err != nil {
-		return ""
+		return 0, false
+	}
+	speed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || speed <= 0 {
+		return 0, false
+	}
+	return speed, true
+}
+
+// reportStatistics sends link counters as volatile facts
+func reportStatistics(facts chan<- ufacter.Fact, device string, stats *n.LinkStatistics) {
+	counters := map[string]uint64{
+		"rx_bytes":   stats.RxBytes,
+		"rx_packets": stats.RxPackets,
+		"rx_errors":  stats.RxErrors,
+		"rx_dropped": stats.RxDropped,
+		"tx_bytes":   stats.TxBytes,
+		"tx_packets": stats.TxPackets,
+		"tx_errors":  stats.TxErrors,
+		"tx_dropped": stats.TxDropped,
+		"multicast":  stats.Multicast,
+		"collisions": stats.Collisions,
+	}
+	for name, value := range counters {
+		facts <- ufacter.NewVolatileFact(value, "link", device, "stats", name)
+	}
+}
+
+// ReportLinks sends facts of links in snapshot taken via h, which answers
+// further queries; sysfs, udev and generic netlink describe only the network
+// namespace ufacter runs in so they are read only when local is set
+func ReportLinks(facts chan<- ufacter.Fact, h rtnl.Handle, snap *rtnl.Snapshot, local bool, volatile bool) {
+	for _, link := range snap.Links {
+		device := link.Attrs().Name
+
+		facts <- ufacter.NewStableFact(link.Type(), "link", device, "type")
+		if len(link.Attrs().HardwareAddr.String()) > 0 {
+			facts <- ufacter.NewStableFact(link.Attrs().HardwareAddr.String(), "link", device, "mac")
+		}
+		facts <- ufacter.NewStableFact(link.Attrs().OperState.String(), "link", device, "operstate")
+		facts <- ufacter.NewStableFact(link.Attrs().RawFlags&iffLowerUp != 0, "link", device, "carrier")
+		facts <- ufacter.NewStableFact(link.Attrs().RawFlags&iffPromisc != 0, "link", device, "promisc")
+		facts <- ufacter.NewStableFact(flagNames(link.Attrs().RawFlags), "link", device, "flags")
+		facts <- ufacter.NewStableFact(link.Attrs().TxQLen, "link", device, "txqlen")
+		if local {
+			if speed, ok := readSpeed(device); ok {
+				facts <- ufacter.NewStableFact(speed, "link", device, "speed")
+			}
+		}
+		if volatile && link.Attrs().Statistics != nil {
+			reportStatistics(facts, device, link.Attrs().Statistics)
+		}
+		// veth peer may live in another namespace where its index means nothing
+		// here, the peer is reported by name
+		if link.Attrs().ParentIndex != 0 && link.Type() != "veth" {
+			facts <- ufacter.NewStableFact(snap.Name(link.Attrs().ParentIndex), "link", device, "parent")
+		}
+		if link.Attrs().MasterIndex != 0 {
+			facts <- ufacter.NewStableFact(snap.Name(link.Attrs().MasterIndex), "link", device, "master")
+		}
+		if link.Attrs().Slave != nil {
+			facts <- ufacter.NewStableFact(link.Attrs().Slave.SlaveType(), "link", device, "slave")
+		}
+		if names, ok := snap.Names(link.Attrs().Index); ok {
+			if len(names.AltNames) > 0 {
+				facts <- ufacter.NewStableFact(names.AltNames, "link", device, "altnames")
+			}
+			facts <- ufacter.NewStableFact(names.PermMAC, "link", device, "perm_mac")
+		}
+		if local {
+			if udev, err := readUdevNames(link.Attrs().Index); err == nil && len(udev) > 0 {
+				facts <- ufacter.NewStableFact(udev, "link", device, "udev")
+			}
+			reportDevice(facts, device)
+		}
+		reportType(facts, link, snap.Name, local, volatile)
+	}
+
+	// ports are listed on masters (bond slaves, bridge and team ports)
+	types := make(map[int]string)
+	for _, link := range snap.Links {
+		types[link.Attrs().Index] = link.Type()
+	}
+	ports := make(map[int][]string)
+	for _, link := range snap.Links {
+		master := link.Attrs().MasterIndex
+		if master == 0 {
+			continue
+		}
+		ports[master] = append(ports[master], link.Attrs().Name)
+		if types[master] == "bridge" && local {
+			reportBridgePort(facts, link.Attrs().Name)
+		}
+	}
+	for _, link := range snap.Links {
+		list, ok := ports[link.Attrs().Index]
+		if !ok {
+			continue
+		}
+		key := "ports"
+		if link.Type() == "bond" {
+			key = "slaves"
+		}
+		facts <- ufacter.NewStableFact(list, "link", link.Attrs().Name, link.Type(), key)
 	}
 
-	return link.Attrs().Name
+	// VLANs of bridge ports, entries of the bridge itself are included
+	hasBridge := false
+	for _, t := range types {
+		hasBridge = hasBridge || t == "bridge"
+	}
+	if hasBridge {
+		reportBridgeVlans(facts, h, types, snap.Name)
+	}
 }
 
 // ReportFacts adds link information
 func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
 	start := time.Now()
 	defer ufacter.SendLastFact(facts)
+	if c.SkipOffline(facts, "link") {
+		return
+	}
 
-	links, err := n.LinkList()
+	// parent and master names come from the same list as the links
+	snap, err := rtnl.TakeSnapshot(handle)
 	if err == nil {
-		for _, link := range links {
-			device := link.Attrs().Name
-
-			facts <- ufacter.NewStableFact(link.Type(), "link", device, "type")
-			if len(link.Attrs().HardwareAddr.String()) > 0 {
-				facts <- ufacter.NewStableFact(link.Attrs().HardwareAddr.String(), "link", device, "mac")
-			}
-			if link.Attrs().ParentIndex != 0 {
-				facts <- ufacter.NewStableFact(idToName(link.Attrs().ParentIndex), "link", device, "parent")
-			}
-			if link.Attrs().MasterIndex != 0 {
-				facts <- ufacter.NewStableFact(idToName(link.Attrs().MasterIndex), "link", device, "master")
-			}
-			if link.Attrs().Slave != nil {
-				facts <- ufacter.NewStableFact(link.Attrs().Slave.SlaveType(), "link", device, "slave")
-			}
-			if link.Type() == "vlan" {
-				vlan := link.(*n.Vlan)
-				facts <- ufacter.NewStableFact(vlan.VlanId, "link", device, "vlan", "id")
-				facts <- ufacter.NewStableFact(vlan.VlanProtocol, "link", device, "vlan", "protocol")
-			}
-			if link.Type() == "vxlan" {
-				vxlan := link.(*n.Vxlan)
-				facts <- ufacter.NewStableFact(vxlan.VxlanId, "link", device, "vxlan", "id")
-			}
-			if link.Type() == "bond" {
-				bond := link.(*n.Bond)
-				facts <- ufacter.NewStableFact(bond.Mode, "link", device, "bond", "mode")
-			}
-			if link.Type() == "veth" {
-				veth := link.(*n.Veth)
-				facts <- ufacter.NewStableFact(veth.PeerName, "link", device, "peer", "name")
-				facts <- ufacter.NewStableFact(veth.PeerHardwareAddr, "link", device, "peer", "mac")
-			}
-		}
+		ReportLinks(facts, handle, snap, true, volatile)
 	} else {
 		c.LogError(facts, err, "link", "getting list")
 	}
@@ -0,0 +1,302 @@
+package link
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/lzap/ufacter/facts/rtnl"
+	"github.com/lzap/ufacter/lib/ufacter"
+	n "github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+type flagsTPair struct {
+	input    uint32
+	expected []string
+}
+
+func TestFlagNames(t *testing.T) {
+	tests := []flagsTPair{
+		{0, []string{}},
+		{0x11043, []string{"UP", "BROADCAST", "RUNNING", "MULTICAST", "LOWER_UP"}},
+		{0x10049, []string{"UP", "LOOPBACK", "RUNNING", "LOWER_UP"}},
+		{0x1103, []string{"UP", "BROADCAST", "PROMISC", "MULTICAST"}},
+	}
+	for _, pair := range tests {
+		result := flagNames(pair.input)
+		if !reflect.DeepEqual(result, pair.expected) {
+			t.Fatalf("%v != %v", result, pair.expected)
+		}
+	}
+}
+
+// collect runs reporter and returns facts keyed by dotted name
+func collect(report func(facts chan<- ufacter.Fact)) map[string]interface{} {
+	ch := make(chan ufacter.Fact, 1024)
+	report(ch)
+	close(ch)
+	result := make(map[string]interface{})
+	for f := range ch {
+		if f.Value != nil && f.Value != "" {
+			result[f.NameDots()] = f.Value
+		}
+	}
+	return result
+}
+
+func testName(index int) string {
+	return fmt.Sprintf("eth%d", index)
+}
+
+func TestReportBond(t *testing.T) {
+	bond := n.NewLinkBond(n.LinkAttrs{Name: "bond0"})
+	bond.Mode = n.BOND_MODE_802_3AD
+	bond.Miimon = 100
+	bond.LacpRate = n.BOND_LACP_RATE_FAST
+	bond.XmitHashPolicy = n.BOND_XMIT_HASH_POLICY_LAYER3_4
+	result := collect(func(facts chan<- ufacter.Fact) {
+		reportType(facts, bond, testName, true, true)
+	})
+	expected := map[string]interface{}{
+		"link.bond0.bond.mode":             "802.3ad",
+		"link.bond0.bond.miimon":           100,
+		"link.bond0.bond.lacp_rate":        "fast",
+		"link.bond0.bond.xmit_hash_policy": "layer3+4",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+
+	bond.Mode = n.BOND_MODE_ACTIVE_BACKUP
+	bond.ActiveSlave = 3
+	result = collect(func(facts chan<- ufacter.Fact) {
+		reportType(facts, bond, testName, true, true)
+	})
+	if result["link.bond0.bond.active_slave"] != "eth3" || result["link.bond0.bond.lacp_rate"] != nil {
+		t.Fatalf("unexpected active-backup facts %v", result)
+	}
+}
+
+func TestReportBondSlave(t *testing.T) {
+	slave := &n.Device{LinkAttrs: n.LinkAttrs{Name: "eth1", Slave: &n.BondSlave{
+		State:            n.BondStateBackup,
+		MiiStatus:        n.BondLinkUp,
+		LinkFailureCount: 2,
+	}}}
+	result := collect(func(facts chan<- ufacter.Fact) {
+		reportType(facts, slave, testName, true, false)
+	})
+	if result["link.eth1.bond_slave.state"] != "backup" || result["link.eth1.bond_slave.mii_status"] != "up" {
+		t.Fatalf("unexpected slave facts %v", result)
+	}
+	if _, ok := result["link.eth1.bond_slave.link_failure_count"]; ok {
+		t.Fatalf("counter must be volatile")
+	}
+}
+
+func TestReportTunnels(t *testing.T) {
+	links := []n.Link{
+		&n.Vxlan{LinkAttrs: n.LinkAttrs{Name: "vx0"}, VxlanId: 42, SrcAddr: net.ParseIP("10.0.0.1"),
+			Group: net.ParseIP("239.1.1.1"), Port: 4789, VtepDevIndex: 2},
+		&n.Gretun{LinkAttrs: n.LinkAttrs{Name: "gre1"}, Local: net.ParseIP("10.0.0.1"),
+			Remote: net.ParseIP("10.0.0.3"), Ttl: 64},
+		&n.Macvlan{LinkAttrs: n.LinkAttrs{Name: "mv0"}, Mode: n.MACVLAN_MODE_BRIDGE},
+		&n.IPVlan{LinkAttrs: n.LinkAttrs{Name: "ipv0"}, Mode: n.IPVLAN_MODE_L3S, Flag: n.IPVLAN_FLAG_PRIVATE},
+	}
+	result := collect(func(facts chan<- ufacter.Fact) {
+		for _, link := range links {
+			reportType(facts, link, testName, true, false)
+		}
+	})
+	expected := map[string]interface{}{
+		"link.vx0.vxlan.id":       42,
+		"link.vx0.vxlan.local":    "10.0.0.1",
+		"link.vx0.vxlan.group":    "239.1.1.1",
+		"link.vx0.vxlan.port":     4789,
+		"link.vx0.vxlan.device":   "eth2",
+		"link.vx0.vxlan.learning": false,
+		"link.gre1.tunnel.local":  "10.0.0.1",
+		"link.gre1.tunnel.remote": "10.0.0.3",
+		"link.gre1.tunnel.ttl":    uint8(64),
+		"link.mv0.macvlan.mode":   "bridge",
+		"link.ipv0.ipvlan.mode":   "l3s",
+		"link.ipv0.ipvlan.flag":   "private",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+}
+
+// nested returns parsed attributes of serialized nested attribute
+func nested(t *testing.T, attr *nl.RtAttr) []syscall.NetlinkRouteAttr {
+	attrs, err := nl.ParseRouteAttr(attr.Serialize())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return attrs
+}
+
+func TestParseWireguard(t *testing.T) {
+	native := nl.NativeEndian()
+	key := make([]byte, 32)
+	key[0] = 1
+	endpoint := make([]byte, 16)
+	native.PutUint16(endpoint[0:], syscall.AF_INET)
+	binary.BigEndian.PutUint16(endpoint[2:], 51820)
+	copy(endpoint[4:], net.ParseIP("192.0.2.1").To4())
+
+	msg := []*nl.RtAttr{
+		nl.NewRtAttr(wgDeviceListenPort, nl.Uint16Attr(51820)),
+		nl.NewRtAttr(wgDevicePublicKey, key),
+	}
+	peers := nl.NewRtAttr(wgDevicePeers|nl.NLA_F_NESTED, nil)
+	peer := peers.AddRtAttr(0|nl.NLA_F_NESTED, nil)
+	peer.AddRtAttr(wgPeerPublicKey, key)
+	peer.AddRtAttr(wgPeerEndpoint, endpoint)
+	peer.AddRtAttr(wgPeerKeepalive, nl.Uint16Attr(25))
+	ips := peer.AddRtAttr(wgPeerAllowedIPs|nl.NLA_F_NESTED, nil)
+	ip := ips.AddRtAttr(0|nl.NLA_F_NESTED, nil)
+	ip.AddRtAttr(wgAllowedIPFamily, nl.Uint16Attr(syscall.AF_INET))
+	ip.AddRtAttr(wgAllowedIPAddr, net.ParseIP("10.10.0.0").To4())
+	ip.AddRtAttr(wgAllowedIPMask, []byte{16})
+	msg = append(msg, peers)
+
+	attrs := []syscall.NetlinkRouteAttr{}
+	for _, attr := range msg {
+		attrs = append(attrs, nested(t, attr)...)
+	}
+	wg := parseWireguard([][]syscall.NetlinkRouteAttr{attrs})
+	encoded := "AQAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+	if wg.listenPort != 51820 || wg.publicKey != encoded || len(wg.peers) != 1 {
+		t.Fatalf("unexpected device %v", wg)
+	}
+	expected := wgPeer{publicKey: encoded, endpoint: "192.0.2.1:51820", allowedIPs: []string{"10.10.0.0/16"}, keepalive: 25}
+	if !reflect.DeepEqual(wg.peers[0], expected) {
+		t.Fatalf("%v != %v", wg.peers[0], expected)
+	}
+}
+
+func TestParseTeamOptions(t *testing.T) {
+	list := nl.NewRtAttr(teamAttrListOption|nl.NLA_F_NESTED, nil)
+	mode := list.AddRtAttr(teamAttrItemOption|nl.NLA_F_NESTED, nil)
+	mode.AddRtAttr(teamOptionName, nl.ZeroTerminated("mode"))
+	mode.AddRtAttr(teamOptionType, []byte{nlaString})
+	mode.AddRtAttr(teamOptionData, nl.ZeroTerminated("activebackup"))
+	active := list.AddRtAttr(teamAttrItemOption|nl.NLA_F_NESTED, nil)
+	active.AddRtAttr(teamOptionName, nl.ZeroTerminated("activeport"))
+	active.AddRtAttr(teamOptionType, []byte{nlaU32})
+	active.AddRtAttr(teamOptionData, nl.Uint32Attr(4))
+	port := list.AddRtAttr(teamAttrItemOption|nl.NLA_F_NESTED, nil)
+	port.AddRtAttr(teamOptionName, nl.ZeroTerminated("enabled"))
+	port.AddRtAttr(teamOptionType, []byte{nlaFlag})
+	port.AddRtAttr(teamOptionPortIfindex, nl.Uint32Attr(4))
+
+	options := parseTeamOptions([][]syscall.NetlinkRouteAttr{nested(t, list)})
+	expected := map[string]interface{}{"mode": "activebackup", "activeport": uint32(4)}
+	if !reflect.DeepEqual(options, expected) {
+		t.Fatalf("%v != %v", options, expected)
+	}
+	result := collect(func(facts chan<- ufacter.Fact) {
+		reportTeam(facts, "team0", options, testName)
+	})
+	if result["link.team0.team.mode"] != "activebackup" || result["link.team0.team.active_port"] != "eth4" {
+		t.Fatalf("unexpected team facts %v", result)
+	}
+}
+
+func TestReadUdevNames(t *testing.T) {
+	os.Setenv("HOST_RUN", filepath.Join("testdata", "run"))
+	defer os.Unsetenv("HOST_RUN")
+	result, err := readUdevNames(2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := map[string]string{"mac": "enx525400aabbcc", "path": "enp0s3f0", "slot": "ens3f0"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+}
+
+func TestReportDevice(t *testing.T) {
+	os.Setenv("HOST_SYS", filepath.Join("testdata", "sys"))
+	defer os.Unsetenv("HOST_SYS")
+	result := collect(func(facts chan<- ufacter.Fact) {
+		reportDevice(facts, "eth0")
+		reportDevice(facts, "eth2")
+		reportDevice(facts, "missing")
+	})
+	expected := map[string]interface{}{
+		"link.eth0.driver":               "ixgbe",
+		"link.eth0.pci.address":          "0000:00:03.0",
+		"link.eth0.pci.vendor":           "0x8086",
+		"link.eth0.pci.device":           "0x10fb",
+		"link.eth0.pci.subsystem_vendor": "0x8086",
+		"link.eth0.pci.subsystem_device": "0x000c",
+		"link.eth0.numa_node":            int64(0),
+		"link.eth0.sriov.totalvfs":       int64(63),
+		"link.eth0.sriov.numvfs":         int64(1),
+		"link.eth0.sriov.vfs": []map[string]interface{}{
+			{"index": 0, "pci": "0000:00:03.2", "devices": []string{"eth2"}},
+		},
+		"link.eth2.driver":       "ixgbevf",
+		"link.eth2.pci.address":  "0000:00:03.2",
+		"link.eth2.pci.vendor":   "0x8086",
+		"link.eth2.pci.device":   "0x10ed",
+		"link.eth2.sriov.pf_pci": "0000:00:03.0",
+		"link.eth2.sriov.pf":     "eth0",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+}
+
+func TestReportFacts(t *testing.T) {
+	os.Setenv("HOST_SYS", filepath.Join("testdata", "sys"))
+	os.Setenv("HOST_RUN", filepath.Join("testdata", "run"))
+	defer os.Unsetenv("HOST_SYS")
+	defer os.Unsetenv("HOST_RUN")
+	fake, err := rtnl.LoadFake(filepath.Join("testdata", "netlink.json"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	previous := handle
+	handle = fake
+	defer func() { handle = previous }()
+
+	result := collect(func(facts chan<- ufacter.Fact) {
+		ReportFacts(facts, false, true)
+	})
+	// parents, masters and VLAN devices are named from the same link list
+	expected := map[string]interface{}{
+		"link.eth0.type":     "device",
+		"link.eth0.flags":    []string{"UP", "BROADCAST", "RUNNING", "SLAVE", "MULTICAST", "LOWER_UP"},
+		"link.eth0.master":   "br0",
+		"link.eth0.altnames": []string{"enp0s3f0"},
+		"link.eth0.perm_mac": "52:54:00:aa:bb:cc",
+		"link.eth0.driver":   "ixgbe",
+		"link.eth0.bridge_port.vlans": []map[string]interface{}{
+			{"vid": uint16(1), "pvid": true, "untagged": true},
+			{"vid": uint16(10), "pvid": false, "untagged": false},
+		},
+		"link.br0.type":         "bridge",
+		"link.br0.bridge.ports": []string{"eth0"},
+		"link.br0.bridge.vlans": []map[string]interface{}{
+			{"vid": uint16(1), "pvid": true, "untagged": true},
+		},
+		"link.br0.10.type":    "vlan",
+		"link.br0.10.parent":  "br0",
+		"link.br0.10.vlan.id": 10,
+		"link.lo.operstate":   "unknown",
+	}
+	for name, value := range expected {
+		if !reflect.DeepEqual(result[name], value) {
+			t.Fatalf("%s: %v != %v", name, result[name], value)
+		}
+	}
+}
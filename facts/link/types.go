@@ -0,0 +1,284 @@
+package link
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	c "github.com/lzap/ufacter/facts/common"
+	"github.com/lzap/ufacter/facts/rtnl"
+	"github.com/lzap/ufacter/lib/ufacter"
+	n "github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+var (
+	// macvlanModes are indexed by n.MacvlanMode
+	macvlanModes = []string{"default", "private", "vepa", "bridge", "passthru", "source"}
+
+	// ipvlanModes are indexed by n.IPVlanMode
+	ipvlanModes = []string{"l2", "l3", "l3s"}
+
+	// ipvlanFlags are indexed by n.IPVlanFlag
+	ipvlanFlags = []string{"bridge", "private", "vepa"}
+
+	// stpStates are values of bridge/stp_state in sysfs
+	stpStates = []string{"disabled", "kernel", "user"}
+
+	// bridgePortStates are values of brport/state in sysfs
+	bridgePortStates = []string{"disabled", "listening", "learning", "forwarding", "blocking"}
+)
+
+// enumName returns name from table or the number when out of range
+func enumName(names []string, value int) string {
+	if value >= 0 && value < len(names) {
+		return names[value]
+	}
+	return strconv.Itoa(value)
+}
+
+// ipString returns empty string for unset addresses so the fact is skipped
+func ipString(ip net.IP) string {
+	if ip == nil || ip.IsUnspecified() {
+		return ""
+	}
+	return ip.String()
+}
+
+// readSysfsInt reads integer from sysfs attribute of a network device
+func readSysfsInt(device string, attr ...string) (int64, bool) {
+	path := append([]string{"sys", "class", "net", device}, attr...)
+	value, err := c.ReadFileString(c.HostPath(path...))
+	if err != nil {
+		return 0, false
+	}
+	number, err := strconv.ParseInt(value, 10, 64)
+	return number, err == nil
+}
+
+func reportBond(facts chan<- ufacter.Fact, device string, bond *n.Bond, name func(int) string) {
+	if bond.Mode >= 0 {
+		facts <- ufacter.NewStableFact(bond.Mode.String(), "link", device, "bond", "mode")
+	}
+	if bond.Miimon >= 0 {
+		facts <- ufacter.NewStableFact(bond.Miimon, "link", device, "bond", "miimon")
+	}
+	if bond.UpDelay >= 0 {
+		facts <- ufacter.NewStableFact(bond.UpDelay, "link", device, "bond", "updelay")
+	}
+	if bond.DownDelay >= 0 {
+		facts <- ufacter.NewStableFact(bond.DownDelay, "link", device, "bond", "downdelay")
+	}
+	switch bond.Mode {
+	case n.BOND_MODE_802_3AD:
+		if bond.LacpRate >= 0 {
+			facts <- ufacter.NewStableFact(bond.LacpRate.String(), "link", device, "bond", "lacp_rate")
+		}
+		if bond.AdInfo != nil {
+			facts <- ufacter.NewStableFact(bond.AdInfo.AggregatorId, "link", device, "bond", "ad_info", "aggregator_id")
+			facts <- ufacter.NewStableFact(bond.AdInfo.NumPorts, "link", device, "bond", "ad_info", "num_ports")
+			facts <- ufacter.NewStableFact(bond.AdInfo.PartnerMac.String(), "link", device, "bond", "ad_info", "partner_mac")
+		}
+		fallthrough
+	case n.BOND_MODE_BALANCE_XOR, n.BOND_MODE_BALANCE_TLB:
+		if bond.XmitHashPolicy >= 0 {
+			facts <- ufacter.NewStableFact(bond.XmitHashPolicy.String(), "link", device, "bond", "xmit_hash_policy")
+		}
+	}
+	if bond.ActiveSlave > 0 {
+		facts <- ufacter.NewStableFact(name(bond.ActiveSlave), "link", device, "bond", "active_slave")
+	}
+}
+
+func reportBondSlave(facts chan<- ufacter.Fact, device string, slave *n.BondSlave, volatile bool) {
+	facts <- ufacter.NewStableFact(strings.ToLower(slave.State.String()), "link", device, "bond_slave", "state")
+	facts <- ufacter.NewStableFact(strings.ToLower(slave.MiiStatus.String()), "link", device, "bond_slave", "mii_status")
+	facts <- ufacter.NewStableFact(slave.PermHardwareAddr.String(), "link", device, "bond_slave", "perm_mac")
+	facts <- ufacter.NewStableFact(slave.QueueId, "link", device, "bond_slave", "queue_id")
+	if slave.AggregatorId != 0 {
+		facts <- ufacter.NewStableFact(slave.AggregatorId, "link", device, "bond_slave", "aggregator_id")
+	}
+	if volatile {
+		facts <- ufacter.NewVolatileFact(slave.LinkFailureCount, "link", device, "bond_slave", "link_failure_count")
+	}
+}
+
+func reportBridge(facts chan<- ufacter.Fact, device string, bridge *n.Bridge, local bool) {
+	if bridge.VlanFiltering != nil {
+		facts <- ufacter.NewStableFact(*bridge.VlanFiltering, "link", device, "bridge", "vlan_filtering")
+	}
+	if bridge.MulticastSnooping != nil {
+		facts <- ufacter.NewStableFact(*bridge.MulticastSnooping, "link", device, "bridge", "multicast_snooping")
+	}
+	if !local {
+		return
+	}
+	if state, ok := readSysfsInt(device, "bridge", "stp_state"); ok {
+		facts <- ufacter.NewStableFact(enumName(stpStates, int(state)), "link", device, "bridge", "stp_state")
+	}
+	// timers are in hundredths of a second
+	if delay, ok := readSysfsInt(device, "bridge", "forward_delay"); ok {
+		facts <- ufacter.NewStableFact(float64(delay)/100, "link", device, "bridge", "forward_delay")
+	}
+}
+
+func reportBridgePort(facts chan<- ufacter.Fact, device string) {
+	if state, ok := readSysfsInt(device, "brport", "state"); ok {
+		facts <- ufacter.NewStableFact(enumName(bridgePortStates, int(state)), "link", device, "bridge_port", "state")
+	}
+}
+
+// bridgeVlans converts bridge VLAN entries to list of maps
+func bridgeVlans(vlans []*nl.BridgeVlanInfo) []map[string]interface{} {
+	result := []map[string]interface{}{}
+	for _, vlan := range vlans {
+		result = append(result, map[string]interface{}{
+			"vid":      vlan.Vid,
+			"pvid":     vlan.PortVID(),
+			"untagged": vlan.EngressUntag(),
+		})
+	}
+	return result
+}
+
+// reportBridgeVlans sends VLANs of bridges and bridge ports
+func reportBridgeVlans(facts chan<- ufacter.Fact, h rtnl.Handle, types map[int]string, name func(int) string) {
+	vlans, err := h.BridgeVlanList()
+	if err != nil {
+		c.LogError(facts, err, "link", "bridge vlans")
+		return
+	}
+	for index, list := range vlans {
+		device := name(int(index))
+		if device == "" {
+			continue
+		}
+		if types[int(index)] == "bridge" {
+			facts <- ufacter.NewStableFact(bridgeVlans(list), "link", device, "bridge", "vlans")
+		} else {
+			facts <- ufacter.NewStableFact(bridgeVlans(list), "link", device, "bridge_port", "vlans")
+		}
+	}
+}
+
+func reportVxlan(facts chan<- ufacter.Fact, device string, vxlan *n.Vxlan, name func(int) string) {
+	facts <- ufacter.NewStableFact(vxlan.VxlanId, "link", device, "vxlan", "id")
+	facts <- ufacter.NewStableFact(ipString(vxlan.SrcAddr), "link", device, "vxlan", "local")
+	if vxlan.Group != nil && vxlan.Group.IsMulticast() {
+		facts <- ufacter.NewStableFact(ipString(vxlan.Group), "link", device, "vxlan", "group")
+	} else {
+		facts <- ufacter.NewStableFact(ipString(vxlan.Group), "link", device, "vxlan", "remote")
+	}
+	if vxlan.Port > 0 {
+		facts <- ufacter.NewStableFact(vxlan.Port, "link", device, "vxlan", "port")
+	}
+	if vxlan.VtepDevIndex > 0 {
+		facts <- ufacter.NewStableFact(name(vxlan.VtepDevIndex), "link", device, "vxlan", "device")
+	}
+	facts <- ufacter.NewStableFact(vxlan.Learning, "link", device, "vxlan", "learning")
+}
+
+// reportTunnel sends endpoints of IP tunnels
+func reportTunnel(facts chan<- ufacter.Fact, device string, local net.IP, remote net.IP, ttl uint8, link uint32, name func(int) string) {
+	facts <- ufacter.NewStableFact(ipString(local), "link", device, "tunnel", "local")
+	facts <- ufacter.NewStableFact(ipString(remote), "link", device, "tunnel", "remote")
+	facts <- ufacter.NewStableFact(ttl, "link", device, "tunnel", "ttl")
+	if link != 0 {
+		facts <- ufacter.NewStableFact(name(int(link)), "link", device, "tunnel", "device")
+	}
+}
+
+func reportWireguard(facts chan<- ufacter.Fact, device string, wg *wgDevice, volatile bool) {
+	facts <- ufacter.NewStableFact(wg.publicKey, "link", device, "wireguard", "public_key")
+	facts <- ufacter.NewStableFact(wg.listenPort, "link", device, "wireguard", "listen_port")
+	if wg.fwmark != 0 {
+		facts <- ufacter.NewStableFact(wg.fwmark, "link", device, "wireguard", "fwmark")
+	}
+	for _, peer := range wg.peers {
+		facts <- ufacter.NewStableFact(peer.endpoint, "link", device, "wireguard", "peers", peer.publicKey, "endpoint")
+		facts <- ufacter.NewStableFact(peer.allowedIPs, "link", device, "wireguard", "peers", peer.publicKey, "allowed_ips")
+		if peer.keepalive != 0 {
+			facts <- ufacter.NewStableFact(peer.keepalive, "link", device, "wireguard", "peers", peer.publicKey, "persistent_keepalive")
+		}
+		if volatile {
+			if peer.lastHandshake != 0 {
+				facts <- ufacter.NewVolatileFact(peer.lastHandshake, "link", device, "wireguard", "peers", peer.publicKey, "latest_handshake")
+			}
+			facts <- ufacter.NewVolatileFact(peer.rxBytes, "link", device, "wireguard", "peers", peer.publicKey, "rx_bytes")
+			facts <- ufacter.NewVolatileFact(peer.txBytes, "link", device, "wireguard", "peers", peer.publicKey, "tx_bytes")
+		}
+	}
+}
+
+func reportTeam(facts chan<- ufacter.Fact, device string, options map[string]interface{}, name func(int) string) {
+	if mode, ok := options["mode"].(string); ok {
+		facts <- ufacter.NewStableFact(mode, "link", device, "team", "mode")
+	}
+	if port, ok := options["activeport"].(uint32); ok && port != 0 {
+		facts <- ufacter.NewStableFact(name(int(port)), "link", device, "team", "active_port")
+	}
+}
+
+// reportType sends facts specific to link type, errors are reported for
+// types which need additional queries, which are made only for local links
+func reportType(facts chan<- ufacter.Fact, link n.Link, name func(int) string, local bool, volatile bool) {
+	device := link.Attrs().Name
+	switch l := link.(type) {
+	case *n.Vlan:
+		facts <- ufacter.NewStableFact(l.VlanId, "link", device, "vlan", "id")
+		facts <- ufacter.NewStableFact(l.VlanProtocol, "link", device, "vlan", "protocol")
+	case *n.Vxlan:
+		reportVxlan(facts, device, l, name)
+	case *n.Bond:
+		reportBond(facts, device, l, name)
+	case *n.Bridge:
+		reportBridge(facts, device, l, local)
+	case *n.Veth:
+		facts <- ufacter.NewStableFact(l.PeerName, "link", device, "peer", "name")
+		facts <- ufacter.NewStableFact(l.PeerHardwareAddr.String(), "link", device, "peer", "mac")
+	case *n.Macvlan:
+		facts <- ufacter.NewStableFact(enumName(macvlanModes, int(l.Mode)), "link", device, "macvlan", "mode")
+	case *n.Macvtap:
+		facts <- ufacter.NewStableFact(enumName(macvlanModes, int(l.Mode)), "link", device, "macvtap", "mode")
+	case *n.IPVlan:
+		facts <- ufacter.NewStableFact(enumName(ipvlanModes, int(l.Mode)), "link", device, "ipvlan", "mode")
+		facts <- ufacter.NewStableFact(enumName(ipvlanFlags, int(l.Flag)), "link", device, "ipvlan", "flag")
+	case *n.Gretun:
+		reportTunnel(facts, device, l.Local, l.Remote, l.Ttl, l.Link, name)
+	case *n.Gretap:
+		reportTunnel(facts, device, l.Local, l.Remote, l.Ttl, l.Link, name)
+	case *n.Iptun:
+		reportTunnel(facts, device, l.Local, l.Remote, l.Ttl, l.Link, name)
+	case *n.Sittun:
+		reportTunnel(facts, device, l.Local, l.Remote, l.Ttl, l.Link, name)
+	case *n.Ip6tnl:
+		reportTunnel(facts, device, l.Local, l.Remote, l.Ttl, l.Link, name)
+	case *n.Vti:
+		reportTunnel(facts, device, l.Local, l.Remote, 0, l.Link, name)
+	case *n.GenericLink:
+		if !local {
+			break
+		}
+		switch l.LinkType {
+		case "wireguard":
+			wg, err := queryWireguard(l.Index)
+			if err == nil {
+				reportWireguard(facts, device, wg, volatile)
+			} else {
+				c.LogError(facts, err, "link", device, "wireguard")
+			}
+		case "team":
+			options, err := queryTeam(l.Index)
+			if err == nil {
+				reportTeam(facts, device, options, name)
+			} else {
+				c.LogError(facts, err, "link", device, "team")
+			}
+		}
+	}
+
+	switch slave := link.Attrs().Slave.(type) {
+	case *n.BondSlave:
+		reportBondSlave(facts, device, slave, volatile)
+	}
+}
@@ -0,0 +1,144 @@
+package load
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	c "github.com/lzap/ufacter/facts/common"
+	"github.com/lzap/ufacter/lib/ufacter"
+	l "github.com/shirou/gopsutil/load"
+)
+
+// processStats is a summary of all processes from /proc
+type processStats struct {
+	count   uint64
+	threads uint64
+	zombies uint64
+}
+
+// parseStat returns state and number of threads from /proc/PID/stat, the
+// command name can contain spaces and parentheses so it is skipped first
+func parseStat(stat string) (string, uint64, bool) {
+	idx := strings.LastIndex(stat, ")")
+	if idx < 0 {
+		return "", 0, false
+	}
+	// fields after command: state(3) ... num_threads(20)
+	fields := strings.Fields(stat[idx+1:])
+	if len(fields) < 18 {
+		return "", 0, false
+	}
+	threads, err := strconv.ParseUint(fields[17], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return fields[0], threads, true
+}
+
+// readProcesses scans all process directories, processes which exit
+// during the scan are skipped
+func readProcesses(proc string) (*processStats, error) {
+	entries, err := ioutil.ReadDir(proc)
+	if err != nil {
+		return nil, err
+	}
+	result := &processStats{}
+	for _, entry := range entries {
+		if _, err := strconv.ParseUint(entry.Name(), 10, 64); err != nil || !entry.IsDir() {
+			continue
+		}
+		stat, err := ioutil.ReadFile(filepath.Join(proc, entry.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		state, threads, ok := parseStat(string(stat))
+		if !ok {
+			continue
+		}
+		result.count++
+		result.threads += threads
+		if state == "Z" {
+			result.zombies++
+		}
+	}
+	return result, nil
+}
+
+// readUints reads whitespace separated unsigned numbers from a file
+func readUints(filename string) ([]uint64, error) {
+	content, err := c.ReadFileString(filename)
+	if err != nil {
+		return nil, err
+	}
+	result := []uint64{}
+	for _, field := range strings.Fields(content) {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+	}
+	return result, nil
+}
+
+// ReportFacts gathers load averages, process counts, file handles and
+// entropy, most of these facts are volatile
+func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
+	start := time.Now()
+	defer ufacter.SendLastFact(facts)
+	proc := c.GetHostProc()
+
+	if volatile {
+		avg, err := l.Avg()
+		if err == nil {
+			facts <- ufacter.NewVolatileFact(avg.Load1, "load_averages", "1m")
+			facts <- ufacter.NewVolatileFact(avg.Load5, "load_averages", "5m")
+			facts <- ufacter.NewVolatileFact(avg.Load15, "load_averages", "15m")
+		} else {
+			c.LogError(facts, err, "load", "avg")
+		}
+
+		processes, err := readProcesses(proc)
+		if err == nil {
+			facts <- ufacter.NewVolatileFactEx(processes.count, "processes", "count")
+			facts <- ufacter.NewVolatileFactEx(processes.threads, "processes", "threads")
+			facts <- ufacter.NewVolatileFactEx(processes.zombies, "processes", "zombies")
+		} else {
+			c.LogError(facts, err, "load", "processes")
+		}
+	}
+
+	// allocated, allocated but unused (always zero since 2.6) and maximum
+	fileNr, err := readUints(filepath.Join(proc, "sys", "fs", "file-nr"))
+	if err == nil && len(fileNr) == 3 {
+		facts <- ufacter.NewStableFactEx(fileNr[2], "file_handles", "max")
+		if volatile {
+			facts <- ufacter.NewVolatileFactEx(fileNr[0]-fileNr[1], "file_handles", "used")
+			if fileNr[2] > 0 {
+				used := float64(fileNr[0]-fileNr[1]) / float64(fileNr[2]) * 100
+				facts <- ufacter.NewVolatileFactEx(used, "file_handles", "used_percent")
+			}
+		}
+	} else if err != nil {
+		c.LogError(facts, err, "load", "file-nr")
+	}
+
+	random := filepath.Join(proc, "sys", "kernel", "random")
+	poolSize, err := readUints(filepath.Join(random, "poolsize"))
+	if err == nil && len(poolSize) == 1 {
+		facts <- ufacter.NewStableFactEx(poolSize[0], "entropy", "pool_size")
+	}
+	if volatile {
+		available, err := readUints(filepath.Join(random, "entropy_avail"))
+		if err == nil && len(available) == 1 {
+			facts <- ufacter.NewVolatileFactEx(available[0], "entropy", "available")
+		} else if err != nil {
+			c.LogError(facts, err, "load", "entropy")
+		}
+	}
+
+	ufacter.SendVolatileFactEx(facts, time.Since(start), "ufacter", "stats", "load")
+}
@@ -0,0 +1,51 @@
+package load
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type statTPair struct {
+	input   string
+	state   string
+	threads uint64
+	ok      bool
+}
+
+func TestParseStat(t *testing.T) {
+	tests := []statTPair{
+		{"1 (systemd) S 0 1 1 0 -1 4194560 61917 2513498 107 1430 193 279 5567 3036 20 0 1 0 12 175833088", "S", 1, true},
+		{"42 (a) b) Z 1 42 42 0 -1 0 0 0 0 0 0 0 0 0 20 0 3 0 120 0", "Z", 3, true},
+		{"42 (truncated) S 1 42", "", 0, false},
+		{"garbage", "", 0, false},
+	}
+	for _, pair := range tests {
+		state, threads, ok := parseStat(pair.input)
+		if state != pair.state || threads != pair.threads || ok != pair.ok {
+			t.Fatalf("%v %v %v != %v %v %v", state, threads, ok, pair.state, pair.threads, pair.ok)
+		}
+	}
+}
+
+func TestReadProcesses(t *testing.T) {
+	result, err := readProcesses(filepath.Join("testdata", "proc"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := processStats{count: 3, threads: 10, zombies: 1}
+	if *result != expected {
+		t.Fatalf("%v != %v", *result, expected)
+	}
+}
+
+func TestReadUints(t *testing.T) {
+	result, err := readUints(filepath.Join("testdata", "proc", "sys", "fs", "file-nr"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := []uint64{2304, 0, 9223372036854775807}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+}
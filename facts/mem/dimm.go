@@ -0,0 +1,253 @@
+package mem
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	c "github.com/lzap/ufacter/facts/common"
+	"github.com/lzap/ufacter/lib/ufacter"
+)
+
+// SMBIOS structure type of Memory Device entries
+const smbiosMemoryDevice = 17
+
+// memory types as defined in DSP0134 (SMBIOS specification) 7.18.2
+var memoryTypes = map[byte]string{
+	0x01: "Other",
+	0x02: "Unknown",
+	0x03: "DRAM",
+	0x04: "EDRAM",
+	0x05: "VRAM",
+	0x06: "SRAM",
+	0x07: "RAM",
+	0x08: "ROM",
+	0x09: "Flash",
+	0x0A: "EEPROM",
+	0x0B: "FEPROM",
+	0x0C: "EPROM",
+	0x0D: "CDRAM",
+	0x0E: "3DRAM",
+	0x0F: "SDRAM",
+	0x10: "SGRAM",
+	0x11: "RDRAM",
+	0x12: "DDR",
+	0x13: "DDR2",
+	0x14: "DDR2 FB-DIMM",
+	0x18: "DDR3",
+	0x19: "FBD2",
+	0x1A: "DDR4",
+	0x1B: "LPDDR",
+	0x1C: "LPDDR2",
+	0x1D: "LPDDR3",
+	0x1E: "LPDDR4",
+	0x1F: "Logical non-volatile device",
+	0x20: "HBM",
+	0x21: "HBM2",
+	0x22: "DDR5",
+	0x23: "LPDDR5",
+	0x24: "HBM3",
+}
+
+// form factors as defined in DSP0134 (SMBIOS specification) 7.18.1
+var formFactors = map[byte]string{
+	0x01: "Other",
+	0x02: "Unknown",
+	0x03: "SIMM",
+	0x04: "SIP",
+	0x05: "Chip",
+	0x06: "DIP",
+	0x07: "ZIP",
+	0x08: "Proprietary Card",
+	0x09: "DIMM",
+	0x0A: "TSOP",
+	0x0B: "Row of chips",
+	0x0C: "RIMM",
+	0x0D: "SODIMM",
+	0x0E: "SRIMM",
+	0x0F: "FB-DIMM",
+	0x10: "Die",
+}
+
+// dimm represents SMBIOS Memory Device (type 17) structure
+type dimm struct {
+	locator         string
+	bankLocator     string
+	size            uint64
+	formFactor      string
+	memoryType      string
+	speed           uint32
+	configuredSpeed uint32
+	manufacturer    string
+	serial          string
+	partNumber      string
+}
+
+// smbiosStrings returns strings from the unformatted section of SMBIOS
+// structure, the first string has index 1
+func smbiosStrings(raw []byte, length int) []string {
+	if length >= len(raw) {
+		return nil
+	}
+	result := []string{}
+	for _, s := range bytes.Split(raw[length:], []byte{0}) {
+		if len(s) == 0 {
+			break
+		}
+		result = append(result, strings.TrimSpace(string(s)))
+	}
+	return result
+}
+
+// parseDIMM parses raw SMBIOS Memory Device structure
+func parseDIMM(raw []byte) (*dimm, error) {
+	if len(raw) < 0x15 || raw[0] != smbiosMemoryDevice {
+		return nil, fmt.Errorf("Invalid SMBIOS memory device structure.")
+	}
+	length := int(raw[1])
+	if length > len(raw) || length < 0x15 {
+		return nil, fmt.Errorf("Invalid SMBIOS memory device length %d.", length)
+	}
+	strs := smbiosStrings(raw, length)
+	str := func(offset int) string {
+		if offset >= length {
+			return ""
+		}
+		idx := int(raw[offset])
+		if idx == 0 || idx > len(strs) {
+			return ""
+		}
+		return strs[idx-1]
+	}
+	word := func(offset int) uint32 {
+		if offset+2 > length {
+			return 0
+		}
+		return uint32(binary.LittleEndian.Uint16(raw[offset:]))
+	}
+	dword := func(offset int) uint32 {
+		if offset+4 > length {
+			return 0
+		}
+		return binary.LittleEndian.Uint32(raw[offset:])
+	}
+
+	result := &dimm{
+		locator:      str(0x10),
+		bankLocator:  str(0x11),
+		formFactor:   formFactors[raw[0x0E]],
+		memoryType:   memoryTypes[raw[0x12]],
+		manufacturer: str(0x17),
+		serial:       str(0x18),
+		partNumber:   str(0x1A),
+	}
+
+	size := word(0x0C)
+	switch {
+	case size == 0 || size == 0xFFFF:
+		// not installed or unknown
+	case size == 0x7FFF:
+		result.size = uint64(dword(0x1C)&0x7FFFFFFF) * 1024 * 1024
+	case size&0x8000 != 0:
+		result.size = uint64(size&0x7FFF) * 1024
+	default:
+		result.size = uint64(size) * 1024 * 1024
+	}
+
+	result.speed = word(0x15)
+	if result.speed == 0xFFFF {
+		result.speed = dword(0x54)
+	}
+	result.configuredSpeed = word(0x20)
+	if result.configuredSpeed == 0xFFFF {
+		result.configuredSpeed = dword(0x58)
+	}
+	return result, nil
+}
+
+// readDIMMs reads all memory device entries exported by the kernel from
+// /sys/firmware/dmi/entries, which is only readable by root; entries which
+// cannot be read or parsed are logged and skipped
+func readDIMMs(facts chan<- ufacter.Fact) ([]*dimm, error) {
+	entriesDir := c.HostPath("sys", "firmware", "dmi", "entries")
+	contents, err := ioutil.ReadDir(entriesDir)
+	if err != nil {
+		return nil, err
+	}
+	prefix := fmt.Sprintf("%d-", smbiosMemoryDevice)
+	entries := []int{}
+	for _, v := range contents {
+		if !strings.HasPrefix(v.Name(), prefix) {
+			continue
+		}
+		idx, err := strconv.Atoi(strings.TrimPrefix(v.Name(), prefix))
+		if err == nil {
+			entries = append(entries, idx)
+		}
+	}
+	sort.Ints(entries)
+
+	result := []*dimm{}
+	for _, idx := range entries {
+		raw, err := ioutil.ReadFile(filepath.Join(entriesDir, fmt.Sprintf("%s%d", prefix, idx), "raw"))
+		if os.IsPermission(err) {
+			// all entries are readable by root only
+			return nil, err
+		}
+		if err == nil {
+			var d *dimm
+			if d, err = parseDIMM(raw); err == nil {
+				result = append(result, d)
+				continue
+			}
+		}
+		c.LogError(facts, err, "mem", "dimm", strconv.Itoa(idx))
+	}
+	return result, nil
+}
+
+func reportDIMMs(facts chan<- ufacter.Fact) {
+	dimms, err := readDIMMs(facts)
+	if err != nil {
+		if !os.IsNotExist(err) && !os.IsPermission(err) {
+			c.LogError(facts, err, "mem", "dimms")
+		}
+		return
+	}
+	if len(dimms) == 0 {
+		return
+	}
+
+	inventory := make([]map[string]interface{}, 0, len(dimms))
+	for _, d := range dimms {
+		slot := map[string]interface{}{
+			"locator":    d.locator,
+			"size_bytes": d.size,
+			"size":       c.ConvertBytesAsString(d.size),
+		}
+		if d.bankLocator != "" {
+			slot["bank"] = d.bankLocator
+		}
+		if d.size > 0 {
+			slot["type"] = d.memoryType
+			slot["form_factor"] = d.formFactor
+			if d.speed > 0 {
+				slot["speed"] = fmt.Sprintf("%d MT/s", d.speed)
+			}
+			if d.configuredSpeed > 0 {
+				slot["configured_speed"] = fmt.Sprintf("%d MT/s", d.configuredSpeed)
+			}
+			slot["manufacturer"] = d.manufacturer
+			slot["part_number"] = d.partNumber
+			slot["serial"] = d.serial
+		}
+		inventory = append(inventory, slot)
+	}
+	facts <- ufacter.NewStableFactEx(inventory, "memory", "dimms")
+}
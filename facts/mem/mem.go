@@ -1,7 +1,14 @@
 package mem
 
 import (
+	"bufio"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	c "github.com/lzap/ufacter/facts/common"
@@ -9,6 +16,19 @@ import (
 	m "github.com/shirou/gopsutil/mem"
 )
 
+var (
+	reHugepagesDir = regexp.MustCompile("^hugepages-([0-9]+)kB$")
+	reNodeDir      = regexp.MustCompile("^node[0-9]+$")
+	reSelected     = regexp.MustCompile("\\[([^]]+)\\]")
+)
+
+// overcommit policies as described in Documentation/vm/overcommit-accounting
+var overcommitPolicies = map[uint64]string{
+	0: "heuristic",
+	1: "always",
+	2: "never",
+}
+
 func reportMemory(facts chan<- ufacter.Fact, volatile bool, value uint64, rootKey string, bytesKey string, totalKey string) {
 	human, unit, err := c.ConvertBytes(value)
 	if err != nil {
@@ -19,6 +39,208 @@ func reportMemory(facts chan<- ufacter.Fact, volatile bool, value uint64, rootKe
 	facts <- ufacter.NewFact(fmt.Sprintf("%.2f %v", human, unit), volatile, "memory", rootKey, totalKey)
 }
 
+// readUint reads a file with a single unsigned number
+func readUint(filename string) (uint64, error) {
+	value, err := c.ReadFileString(filename)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// parseSelected returns the bracketed option from sysfs multiple choice files
+// like "always [madvise] never"
+func parseSelected(contents string) string {
+	match := reSelected.FindStringSubmatch(contents)
+	if match == nil {
+		return strings.TrimSpace(contents)
+	}
+	return match[1]
+}
+
+// swapDevice represents a line from /proc/swaps
+type swapDevice struct {
+	filename string
+	kind     string
+	size     uint64
+	used     uint64
+	priority int64
+}
+
+// parseSwaps parses /proc/swaps, sizes are converted from kB to bytes
+func parseSwaps(contents string) []swapDevice {
+	devices := []swapDevice{}
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] == "Filename" {
+			continue
+		}
+		size, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		used, err := strconv.ParseUint(fields[3], 10, 64)
+		if err != nil {
+			continue
+		}
+		priority, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			continue
+		}
+		devices = append(devices, swapDevice{
+			filename: fields[0],
+			kind:     fields[1],
+			size:     size * 1024,
+			used:     used * 1024,
+			priority: priority,
+		})
+	}
+	return devices
+}
+
+// parseNodeMeminfo parses per-node meminfo ("Node 0 MemTotal: 1024 kB"), values
+// are converted from kB to bytes
+func parseNodeMeminfo(contents string) map[string]uint64 {
+	result := make(map[string]uint64)
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[0] != "Node" {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[3], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 4 && fields[4] == "kB" {
+			value *= 1024
+		}
+		result[strings.TrimSuffix(fields[2], ":")] = value
+	}
+	return result
+}
+
+func reportHugepages(facts chan<- ufacter.Fact, volatile bool) {
+	hugeDir := fmt.Sprintf("%s/kernel/mm/hugepages", c.GetHostSys())
+	contents, err := ioutil.ReadDir(hugeDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			c.LogError(facts, err, "mem", "hugepages")
+		}
+		return
+	}
+	for _, v := range contents {
+		match := reHugepagesDir.FindStringSubmatch(v.Name())
+		if match == nil {
+			continue
+		}
+		sizeKB, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		size := match[1] + "kB"
+		facts <- ufacter.NewStableFactEx(sizeKB*1024, "memory", "hugepages", "sizes", size, "size_bytes")
+		total, err := readUint(filepath.Join(hugeDir, v.Name(), "nr_hugepages"))
+		if err == nil {
+			facts <- ufacter.NewStableFactEx(total, "memory", "hugepages", "sizes", size, "total")
+		} else {
+			c.LogError(facts, err, "mem", "hugepages total")
+		}
+		if volatile {
+			free, err := readUint(filepath.Join(hugeDir, v.Name(), "free_hugepages"))
+			if err == nil {
+				facts <- ufacter.NewVolatileFactEx(free, "memory", "hugepages", "sizes", size, "free")
+			}
+			reserved, err := readUint(filepath.Join(hugeDir, v.Name(), "resv_hugepages"))
+			if err == nil {
+				facts <- ufacter.NewVolatileFactEx(reserved, "memory", "hugepages", "sizes", size, "reserved")
+			}
+		}
+	}
+
+	thpDir := fmt.Sprintf("%s/kernel/mm/transparent_hugepage", c.GetHostSys())
+	for _, name := range []string{"enabled", "defrag"} {
+		value, err := c.ReadFileString(filepath.Join(thpDir, name))
+		if err == nil {
+			facts <- ufacter.NewStableFactEx(parseSelected(value), "memory", "hugepages", "transparent", name)
+		}
+	}
+}
+
+func reportNUMA(facts chan<- ufacter.Fact, volatile bool) {
+	nodeDir := fmt.Sprintf("%s/devices/system/node", c.GetHostSys())
+	contents, err := ioutil.ReadDir(nodeDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			c.LogError(facts, err, "mem", "numa nodes")
+		}
+		return
+	}
+	for _, v := range contents {
+		if !reNodeDir.MatchString(v.Name()) {
+			continue
+		}
+		node := v.Name()
+		meminfo, err := ioutil.ReadFile(filepath.Join(nodeDir, node, "meminfo"))
+		if err != nil {
+			c.LogError(facts, err, "mem", "numa meminfo")
+			continue
+		}
+		values := parseNodeMeminfo(string(meminfo))
+		if total, ok := values["MemTotal"]; ok {
+			facts <- ufacter.NewStableFactEx(total, "memory", "numa", node, "total_bytes")
+			facts <- ufacter.NewStableFactEx(c.ConvertBytesAsString(total), "memory", "numa", node, "total")
+		}
+		if free, ok := values["MemFree"]; ok && volatile {
+			facts <- ufacter.NewVolatileFactEx(free, "memory", "numa", node, "free_bytes")
+			facts <- ufacter.NewVolatileFactEx(c.ConvertBytesAsString(free), "memory", "numa", node, "free")
+		}
+		cpus, err := c.ReadFileString(filepath.Join(nodeDir, node, "cpulist"))
+		if err == nil {
+			facts <- ufacter.NewStableFactEx(cpus, "memory", "numa", node, "cpus")
+		}
+	}
+}
+
+func reportOvercommit(facts chan<- ufacter.Fact) {
+	vmDir := fmt.Sprintf("%s/sys/vm", c.GetHostProc())
+	policy, err := readUint(filepath.Join(vmDir, "overcommit_memory"))
+	if err != nil {
+		c.LogError(facts, err, "mem", "overcommit")
+		return
+	}
+	facts <- ufacter.NewStableFactEx(policy, "memory", "overcommit", "memory")
+	if name, ok := overcommitPolicies[policy]; ok {
+		facts <- ufacter.NewStableFactEx(name, "memory", "overcommit", "policy")
+	}
+	ratio, err := readUint(filepath.Join(vmDir, "overcommit_ratio"))
+	if err == nil {
+		facts <- ufacter.NewStableFactEx(ratio, "memory", "overcommit", "ratio")
+	}
+	kbytes, err := readUint(filepath.Join(vmDir, "overcommit_kbytes"))
+	if err == nil {
+		facts <- ufacter.NewStableFactEx(kbytes*1024, "memory", "overcommit", "limit_bytes")
+	}
+}
+
+func reportSwapDevices(facts chan<- ufacter.Fact, volatile bool) {
+	contents, err := ioutil.ReadFile(fmt.Sprintf("%s/swaps", c.GetHostProc()))
+	if err != nil {
+		c.LogError(facts, err, "mem", "swaps")
+		return
+	}
+	for _, dev := range parseSwaps(string(contents)) {
+		facts <- ufacter.NewStableFactEx(dev.kind, "memory", "swap", "devices", dev.filename, "type")
+		facts <- ufacter.NewStableFactEx(dev.size, "memory", "swap", "devices", dev.filename, "size_bytes")
+		facts <- ufacter.NewStableFactEx(c.ConvertBytesAsString(dev.size), "memory", "swap", "devices", dev.filename, "size")
+		facts <- ufacter.NewStableFactEx(dev.priority, "memory", "swap", "devices", dev.filename, "priority")
+		if volatile {
+			facts <- ufacter.NewVolatileFactEx(dev.used, "memory", "swap", "devices", dev.filename, "used_bytes")
+		}
+	}
+}
+
 // ReportFacts gathers facts related to memory
 func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
 	start := time.Now()
@@ -36,6 +258,14 @@ func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
 
 	// Get the swap information from gopsutil
 	hostSwap, err := m.SwapMemory()
+	if c.Offline() && hostVM != nil {
+		// gopsutil uses sysinfo of the running system, meminfo is in the tree
+		hostSwap, err = &m.SwapMemoryStat{Total: hostVM.SwapTotal, Free: hostVM.SwapFree}, nil
+		hostSwap.Used = hostSwap.Total - hostSwap.Free
+		if hostSwap.Total > 0 {
+			hostSwap.UsedPercent = float64(hostSwap.Used) / float64(hostSwap.Total) * 100
+		}
+	}
 	if err == nil {
 		reportMemory(facts, false, hostSwap.Total, "swap", "total_bytes", "total")
 		reportMemory(facts, true, hostSwap.Used, "swap", "used_bytes", "used")
@@ -43,5 +273,13 @@ func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
 		reportMemory(facts, true, hostSwap.Free, "swap", "available_bytes", "available")
 	}
 
+	if extended {
+		reportSwapDevices(facts, volatile)
+		reportHugepages(facts, volatile)
+		reportNUMA(facts, volatile)
+		reportOvercommit(facts)
+		reportDIMMs(facts)
+	}
+
 	ufacter.SendVolatileFactEx(facts, time.Since(start), "ufacter", "stats", "mem")
 }
@@ -0,0 +1,195 @@
+package mem
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	c "github.com/lzap/ufacter/facts/common"
+	"github.com/lzap/ufacter/lib/ufacter"
+)
+
+type selectedTPair struct {
+	in  string
+	out string
+}
+
+func TestParseSelected(t *testing.T) {
+	testPairs := []selectedTPair{
+		{"always [madvise] never\n", "madvise"},
+		{"[always] madvise never", "always"},
+		{"always defer defer+madvise [madvise] never", "madvise"},
+		{"never", "never"},
+	}
+	for _, pair := range testPairs {
+		out := parseSelected(pair.in)
+		if out != pair.out {
+			t.Fatalf("%v != %v", out, pair.out)
+		}
+	}
+}
+
+func TestParseSwaps(t *testing.T) {
+	contents := `Filename				Type		Size		Used		Priority
+/dev/dm-1                               partition	2097148		1024		-2
+/swapfile                               file		1048572		0		10
+`
+	devices := parseSwaps(contents)
+	if len(devices) != 2 {
+		t.Fatalf("expected 2 devices, got %v", len(devices))
+	}
+	if devices[0].filename != "/dev/dm-1" || devices[0].kind != "partition" {
+		t.Fatalf("unexpected device %v", devices[0])
+	}
+	if devices[0].size != 2097148*1024 || devices[0].used != 1024*1024 || devices[0].priority != -2 {
+		t.Fatalf("unexpected sizes %v", devices[0])
+	}
+	if devices[1].filename != "/swapfile" || devices[1].priority != 10 {
+		t.Fatalf("unexpected device %v", devices[1])
+	}
+}
+
+func TestParseNodeMeminfo(t *testing.T) {
+	contents := `Node 0 MemTotal:        4423416 kB
+Node 0 MemFree:         3382708 kB
+Node 0 HugePages_Total:     0
+`
+	values := parseNodeMeminfo(contents)
+	if values["MemTotal"] != 4423416*1024 {
+		t.Fatalf("%v != %v", values["MemTotal"], 4423416*1024)
+	}
+	if values["MemFree"] != 3382708*1024 {
+		t.Fatalf("%v != %v", values["MemFree"], 3382708*1024)
+	}
+	if values["HugePages_Total"] != 0 {
+		t.Fatalf("%v != 0", values["HugePages_Total"])
+	}
+}
+
+// smbiosDIMM returns SMBIOS 3.2 memory device structure (length 0x54)
+func smbiosDIMM(size uint16, extSize uint32, speed uint16) []byte {
+	raw := make([]byte, 0x54)
+	raw[0] = 17
+	raw[1] = 0x54
+	raw[0x0C] = byte(size)
+	raw[0x0D] = byte(size >> 8)
+	raw[0x0E] = 0x09
+	raw[0x10] = 1
+	raw[0x11] = 2
+	raw[0x12] = 0x1A
+	raw[0x15] = byte(speed)
+	raw[0x16] = byte(speed >> 8)
+	raw[0x17] = 3
+	raw[0x18] = 4
+	raw[0x1A] = 5
+	raw[0x1C] = byte(extSize)
+	raw[0x1D] = byte(extSize >> 8)
+	raw[0x1E] = byte(extSize >> 16)
+	raw[0x1F] = byte(extSize >> 24)
+	raw[0x20] = byte(speed)
+	raw[0x21] = byte(speed >> 8)
+	raw = append(raw, []byte("DIMM A1\x00P0_Node0_Channel0_Dimm0\x00Samsung\x0012345678\x00M393A2K43BB1-CTD    \x00\x00")...)
+	return raw
+}
+
+func TestParseDIMM(t *testing.T) {
+	d, err := parseDIMM(smbiosDIMM(16384, 0, 2666))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if d.locator != "DIMM A1" || d.bankLocator != "P0_Node0_Channel0_Dimm0" {
+		t.Fatalf("unexpected locators %v", d)
+	}
+	if d.size != 16*1024*1024*1024 {
+		t.Fatalf("%v != %v", d.size, 16*1024*1024*1024)
+	}
+	if d.memoryType != "DDR4" || d.formFactor != "DIMM" {
+		t.Fatalf("unexpected type %v", d)
+	}
+	if d.speed != 2666 || d.configuredSpeed != 2666 {
+		t.Fatalf("unexpected speed %v", d)
+	}
+	if d.manufacturer != "Samsung" || d.serial != "12345678" || d.partNumber != "M393A2K43BB1-CTD" {
+		t.Fatalf("unexpected strings %v", d)
+	}
+}
+
+func TestParseDIMMSizes(t *testing.T) {
+	d, err := parseDIMM(smbiosDIMM(0x7FFF, 65536, 0))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if d.size != 64*1024*1024*1024 {
+		t.Fatalf("extended size %v != %v", d.size, 64*1024*1024*1024)
+	}
+	d, err = parseDIMM(smbiosDIMM(0x8000|512, 0, 0))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if d.size != 512*1024 {
+		t.Fatalf("kB size %v != %v", d.size, 512*1024)
+	}
+	d, err = parseDIMM(smbiosDIMM(0, 0, 0))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if d.size != 0 {
+		t.Fatalf("empty slot size %v != 0", d.size)
+	}
+}
+
+func TestParseDIMMInvalid(t *testing.T) {
+	if _, err := parseDIMM([]byte{16, 0x17}); err == nil {
+		t.Fatalf("expected error for wrong structure type")
+	}
+	raw := smbiosDIMM(1024, 0, 0)
+	raw[1] = 0xFF
+	if _, err := parseDIMM(raw[:0x54]); err == nil {
+		t.Fatalf("expected error for invalid length")
+	}
+}
+
+func TestReportDIMMsSkipsInvalid(t *testing.T) {
+	root, err := ioutil.TempDir("", "ufacter-mem")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(root)
+	corrupt := smbiosDIMM(1024, 0, 0)
+	corrupt[1] = 0xFF
+	entries := map[string][]byte{
+		"17-0": smbiosDIMM(16384, 0, 2666),
+		"17-1": corrupt,
+		"17-2": smbiosDIMM(8192, 0, 2666),
+	}
+	for name, raw := range entries {
+		dir := filepath.Join(root, "sys", "firmware", "dmi", "entries", name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "raw"), raw, 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	if err := c.SetHostRoot(root); err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer c.ResetHostRoot()
+
+	report := func(facts chan<- ufacter.Fact, volatile bool, extended bool) {
+		defer ufacter.SendLastFact(facts)
+		reportDIMMs(facts)
+	}
+	result := ufacter.FactMap(ufacter.Collect([]ufacter.Reporter{report}, false, true), false)
+	if _, ok := result["ufacter.errors.mem.dimm.1"]; !ok {
+		t.Fatalf("corrupt entry not logged: %v", result)
+	}
+	dimms, ok := result["memory.dimms"].([]map[string]interface{})
+	if !ok || len(dimms) != 2 {
+		t.Fatalf("%v != 2 dimms", result["memory.dimms"])
+	}
+	if dimms[1]["size_bytes"] != uint64(8192)*1024*1024 {
+		t.Fatalf("%v != 8 GiB", dimms[1]["size_bytes"])
+	}
+}
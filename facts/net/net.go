@@ -21,6 +21,9 @@ type stringMap map[string]string
 func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
 	start := time.Now()
 	defer ufacter.SendLastFact(facts)
+	if c.SkipOffline(facts, "net") {
+		return
+	}
 
 	netIfaces, err := n.Interfaces()
 	if err != nil {
@@ -0,0 +1,271 @@
+package netns
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	c "github.com/lzap/ufacter/facts/common"
+	"github.com/lzap/ufacter/facts/link"
+	"github.com/lzap/ufacter/facts/route"
+	"github.com/lzap/ufacter/facts/rtnl"
+	"github.com/lzap/ufacter/lib/ufacter"
+	n "github.com/vishvananda/netlink"
+	ns "github.com/vishvananda/netns"
+)
+
+// Pids enables scanning of processes for unnamed network namespaces
+var Pids = false
+
+// namespace is a network namespace to report, either named (ip netns) or
+// found via a process
+type namespace struct {
+	name  string
+	path  string
+	inode uint64
+	pid   int
+}
+
+// parseNsLink returns inode from /proc/<pid>/ns/net link target "net:[inode]"
+func parseNsLink(target string) (uint64, bool) {
+	if !strings.HasPrefix(target, "net:[") || !strings.HasSuffix(target, "]") {
+		return 0, false
+	}
+	inode, err := strconv.ParseUint(target[5:len(target)-1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return inode, true
+}
+
+func inodeOf(path string) (uint64, bool) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return 0, false
+	}
+	return st.Ino, true
+}
+
+// namedNamespaces returns namespaces created by ip netns in run/netns
+func namedNamespaces(dir string) ([]namespace, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	result := []namespace{}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		inode, ok := inodeOf(path)
+		if !ok {
+			continue
+		}
+		result = append(result, namespace{name: entry.Name(), path: path, inode: inode})
+	}
+	return result, nil
+}
+
+// pidNamespaces returns one namespace per unique inode found in proc using
+// the lowest pid, namespaces from skip are not returned
+func pidNamespaces(proc string, skip map[uint64]bool) ([]namespace, error) {
+	entries, err := ioutil.ReadDir(proc)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[uint64]int)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		target, err := os.Readlink(filepath.Join(proc, entry.Name(), "ns", "net"))
+		if err != nil {
+			continue
+		}
+		inode, ok := parseNsLink(target)
+		if !ok || skip[inode] {
+			continue
+		}
+		if first, ok := found[inode]; !ok || pid < first {
+			found[inode] = pid
+		}
+	}
+	result := []namespace{}
+	for inode, pid := range found {
+		result = append(result, namespace{
+			name:  fmt.Sprintf("pid-%d", pid),
+			path:  filepath.Join(proc, strconv.Itoa(pid), "ns", "net"),
+			inode: inode,
+			pid:   pid,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].pid < result[j].pid })
+	return result, nil
+}
+
+// routeMap returns route with device name resolved by name
+func routeMap(route n.Route, name func(int) string) map[string]string {
+	r := make(map[string]string)
+	if route.Dst != nil {
+		r["destination"] = route.Dst.String()
+	} else {
+		r["destination"] = "default"
+	}
+	if route.Gw != nil {
+		r["gateway"] = route.Gw.String()
+	}
+	if route.Src != nil {
+		r["source"] = route.Src.String()
+	}
+	if device := name(route.LinkIndex); device != "" {
+		r["device"] = device
+	}
+	r["metric"] = strconv.Itoa(route.Priority)
+	return r
+}
+
+// forward returns channel for link and route reporters which forwards their
+// facts into facts under netns.<name> as extended facts and their errors under
+// ufacter.errors.netns.<name>, the returned function waits for forwarding
+func forward(facts chan<- ufacter.Fact, name string) (chan<- ufacter.Fact, func()) {
+	in := make(chan ufacter.Fact)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for f := range in {
+			if len(f.Name) > 1 && f.Name[0] == "ufacter" && f.Name[1] == "errors" {
+				f.Name = append([]string{"ufacter", "errors", "netns", name}, f.Name[2:]...)
+			} else {
+				f.Name = append([]string{"netns", name}, f.Name...)
+			}
+			f.Native = false
+			facts <- f
+		}
+	}()
+	return in, func() {
+		close(in)
+		<-done
+	}
+}
+
+// reportHandle sends link, address and route facts of a namespace queried
+// via handle, links are reported by the link and route modules
+func reportHandle(facts chan<- ufacter.Fact, name string, h rtnl.Handle, volatile bool, extended bool) {
+	snap, err := rtnl.TakeSnapshot(h)
+	if err != nil {
+		c.LogError(facts, err, "netns", name, "link list")
+		return
+	}
+	shared, wait := forward(facts, name)
+	link.ReportLinks(shared, h, snap, false, volatile)
+	route.ReportPrimary(shared, h, snap, extended)
+	wait()
+
+	for _, l := range snap.Links {
+		device := l.Attrs().Name
+		facts <- ufacter.NewStableFactEx(l.Attrs().MTU, "netns", name, "link", device, "mtu")
+
+		addrs, err := h.AddrList(l, n.FAMILY_ALL)
+		if err != nil {
+			c.LogError(facts, err, "netns", name, "address list")
+			continue
+		}
+		bindings := make([]map[string]string, 0)
+		bindings6 := make([]map[string]string, 0)
+		for _, addr := range addrs {
+			if addr.IP.To4() != nil {
+				bindings = append(bindings, c.Binding(addr.IPNet, extended))
+			} else {
+				bindings6 = append(bindings6, c.Binding(addr.IPNet, extended))
+			}
+		}
+		if len(bindings) > 0 {
+			facts <- ufacter.NewStableFactEx(bindings, "netns", name, "interfaces", device, "bindings")
+		}
+		if len(bindings6) > 0 {
+			facts <- ufacter.NewStableFactEx(bindings6, "netns", name, "interfaces", device, "bindings6")
+		}
+	}
+
+	for _, family := range []struct {
+		family int
+		key    string
+	}{{n.FAMILY_V4, "routes"}, {n.FAMILY_V6, "routes6"}} {
+		routes, err := h.RouteList(nil, family.family)
+		if err != nil {
+			c.LogError(facts, err, "netns", name, family.key)
+			continue
+		}
+		list := make([]map[string]string, 0)
+		for _, r := range routes {
+			list = append(list, routeMap(r, snap.Name))
+		}
+		if len(list) > 0 {
+			facts <- ufacter.NewStableFactEx(list, "netns", name, family.key)
+		}
+	}
+}
+
+// reportNamespace opens namespace and sends its facts
+func reportNamespace(facts chan<- ufacter.Fact, space namespace, volatile bool, extended bool) {
+	handle, err := ns.GetFromPath(space.path)
+	if err != nil {
+		c.LogError(facts, err, "netns", space.name, "open")
+		return
+	}
+	defer handle.Close()
+	h, err := rtnl.NetlinkAt(handle)
+	if err != nil {
+		c.LogError(facts, err, "netns", space.name, "handle")
+		return
+	}
+	defer h.Delete()
+
+	facts <- ufacter.NewStableFactEx(space.inode, "netns", space.name, "inode")
+	if space.pid != 0 {
+		facts <- ufacter.NewStableFactEx(space.pid, "netns", space.name, "pid")
+	}
+	reportHandle(facts, space.name, h, volatile, extended)
+}
+
+// ReportFacts reports links, addresses and routes of named network
+// namespaces and optionally namespaces of running processes
+func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
+	start := time.Now()
+	defer ufacter.SendLastFact(facts)
+	if c.SkipOffline(facts, "netns") {
+		return
+	}
+
+	spaces, err := namedNamespaces(c.HostPath("run", "netns"))
+	if err != nil && !os.IsNotExist(err) {
+		c.LogError(facts, err, "netns", "named")
+	}
+
+	if Pids {
+		// own namespace is reported by link and route modules
+		skip := make(map[uint64]bool)
+		if inode, ok := inodeOf("/proc/self/ns/net"); ok {
+			skip[inode] = true
+		}
+		for _, space := range spaces {
+			skip[space.inode] = true
+		}
+		found, err := pidNamespaces(c.GetHostProc(), skip)
+		if err != nil {
+			c.LogError(facts, err, "netns", "pids")
+		}
+		spaces = append(spaces, found...)
+	}
+
+	for _, space := range spaces {
+		reportNamespace(facts, space, volatile, extended)
+	}
+
+	ufacter.SendVolatileFactEx(facts, time.Since(start), "ufacter", "stats", "netns")
+}
@@ -0,0 +1,155 @@
+package netns
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/lzap/ufacter/facts/rtnl"
+	"github.com/lzap/ufacter/lib/ufacter"
+	n "github.com/vishvananda/netlink"
+)
+
+type nsLinkTPair struct {
+	input string
+	inode uint64
+	ok    bool
+}
+
+func TestParseNsLink(t *testing.T) {
+	tests := []nsLinkTPair{
+		{"net:[4026531992]", 4026531992, true},
+		{"net:[]", 0, false},
+		{"mnt:[4026531841]", 0, false},
+		{"garbage", 0, false},
+	}
+	for _, pair := range tests {
+		inode, ok := parseNsLink(pair.input)
+		if inode != pair.inode || ok != pair.ok {
+			t.Fatalf("%v %v != %v %v", inode, ok, pair.inode, pair.ok)
+		}
+	}
+}
+
+func TestPidNamespaces(t *testing.T) {
+	proc, err := ioutil.TempDir("", "netns")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(proc)
+	links := map[string]string{
+		"1":    "net:[100]",
+		"7":    "net:[200]",
+		"3":    "net:[200]",
+		"12":   "net:[300]",
+		"self": "net:[100]",
+	}
+	for pid, target := range links {
+		dir := filepath.Join(proc, pid, "ns")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := os.Symlink(target, filepath.Join(dir, "net")); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	result, err := pidNamespaces(proc, map[uint64]bool{100: true})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := []namespace{
+		{name: "pid-3", path: filepath.Join(proc, "3", "ns", "net"), inode: 200, pid: 3},
+		{name: "pid-12", path: filepath.Join(proc, "12", "ns", "net"), inode: 300, pid: 12},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+}
+
+func TestRouteMap(t *testing.T) {
+	_, dst, _ := net.ParseCIDR("10.0.0.0/24")
+	names := func(index int) string {
+		if index == 2 {
+			return "eth0"
+		}
+		return ""
+	}
+	tests := []struct {
+		route    n.Route
+		expected map[string]string
+	}{
+		{n.Route{LinkIndex: 2, Gw: net.ParseIP("192.0.2.1"), Priority: 100},
+			map[string]string{"destination": "default", "gateway": "192.0.2.1", "device": "eth0", "metric": "100"}},
+		{n.Route{LinkIndex: 2, Dst: dst, Src: net.ParseIP("10.0.0.5")},
+			map[string]string{"destination": "10.0.0.0/24", "source": "10.0.0.5", "device": "eth0", "metric": "0"}},
+	}
+	for _, pair := range tests {
+		result := routeMap(pair.route, names)
+		if !reflect.DeepEqual(result, pair.expected) {
+			t.Fatalf("%v != %v", result, pair.expected)
+		}
+	}
+}
+
+func TestReportHandle(t *testing.T) {
+	fake, err := rtnl.LoadFake(filepath.Join("testdata", "netlink.json"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	facts := make(chan ufacter.Fact)
+	go func() {
+		reportHandle(facts, "pod", fake, true, false)
+		ufacter.SendLastFact(facts)
+	}()
+	result := make(map[string]ufacter.Fact)
+	for f := range facts {
+		if f.Name == nil {
+			break
+		}
+		result[f.NameDots()] = f
+	}
+
+	// link and route modules report links of the namespace under netns.<name>
+	expected := map[string]interface{}{
+		"netns.pod.link.eth0.type":      "veth",
+		"netns.pod.link.eth0.altnames":  []string{"pod0"},
+		"netns.pod.link.eth0.peer.name": "veth1a2b3c",
+		"netns.pod.link.eth0.mtu":       1450,
+		"netns.pod.networking.primary":  "eth0",
+		"netns.pod.networking.ip":       "10.128.0.5",
+		"netns.pod.networking.mtu":      1450,
+		"netns.pod.interfaces.eth0.bindings6": []map[string]string{
+			{"address": "fd00::5", "netmask": "ffff:ffff:ffff:ffff::", "network": "fd00::"},
+		},
+		"netns.pod.routes": []map[string]string{
+			{"destination": "default", "gateway": "10.128.0.1", "device": "eth0", "metric": "0"},
+			{"destination": "10.128.0.0/23", "source": "10.128.0.5", "device": "eth0", "metric": "0"},
+		},
+	}
+	for name, value := range expected {
+		f, ok := result[name]
+		if !ok || !reflect.DeepEqual(f.Value, value) {
+			t.Fatalf("%s: %v != %v", name, f.Value, value)
+		}
+		if f.Native {
+			t.Fatalf("%s is native", name)
+		}
+	}
+	for name, f := range result {
+		if f.Volatile && !ufacter.IsVolatilePath(name) {
+			t.Fatalf("volatile fact %s is missing in ufacter.VolatilePaths", name)
+		}
+	}
+	// veth peer index belongs to another namespace
+	if f, ok := result["netns.pod.link.eth0.parent"]; ok {
+		t.Fatalf("unexpected parent %v", f.Value)
+	}
+	// IPv6 default route is missing
+	if _, ok := result["ufacter.errors.netns.pod.route.primary6.netlink default route"]; !ok {
+		t.Fatalf("route error not reported under netns: %v", result)
+	}
+}
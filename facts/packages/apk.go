@@ -0,0 +1,46 @@
+package packages
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// splitApkVersion splits version into version and release ("1.2.3-r0")
+func splitApkVersion(full string) (version string, release string) {
+	if idx := strings.LastIndex(full, "-r"); idx > 0 {
+		return full[:idx], full[idx+1:]
+	}
+	return full, ""
+}
+
+func parseApk(r io.Reader) ([]pkg, error) {
+	paragraphs, err := stanzas(r)
+	if err != nil {
+		return nil, err
+	}
+	result := []pkg{}
+	for _, p := range paragraphs {
+		if p["P"] == "" {
+			continue
+		}
+		version, release := splitApkVersion(p["V"])
+		result = append(result, pkg{
+			name:    p["P"],
+			version: version,
+			release: release,
+			arch:    p["A"],
+			source:  p["o"],
+		})
+	}
+	return result, nil
+}
+
+func readApk(filename string) ([]pkg, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseApk(f)
+}
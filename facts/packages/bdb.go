@@ -0,0 +1,138 @@
+package packages
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Berkeley DB hash database constants, see dbinc/db_page.h
+const (
+	bdbHashMagic       = 0x061561
+	bdbPageHeaderSize  = 26
+	bdbHashUnsorted    = 2
+	bdbOverflow        = 7
+	bdbHash            = 13
+	bdbHashOffPage     = 3
+	bdbHashOffPageSize = 12
+)
+
+// bdbPageHeader represents generic Berkeley DB page header
+type bdbPageHeader struct {
+	nextPage   uint32
+	numEntries uint16
+	freeOffset uint16
+	pageType   uint8
+}
+
+func parseBdbPageHeader(page []byte, order binary.ByteOrder) bdbPageHeader {
+	return bdbPageHeader{
+		nextPage:   order.Uint32(page[16:20]),
+		numEntries: order.Uint16(page[20:22]),
+		freeOffset: order.Uint16(page[22:24]),
+		pageType:   page[25],
+	}
+}
+
+// readBdbPage reads page with given number
+func readBdbPage(r io.ReaderAt, pageSize uint32, pageNo uint32) ([]byte, error) {
+	page := make([]byte, pageSize)
+	_, err := r.ReadAt(page, int64(pageNo)*int64(pageSize))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return page, nil
+}
+
+// readBdbOverflow reads value stored in chain of overflow pages
+func readBdbOverflow(r io.ReaderAt, order binary.ByteOrder, pageSize uint32, pageNo uint32, length uint32) ([]byte, error) {
+	value := make([]byte, 0, length)
+	visited := make(map[uint32]bool)
+	for pageNo != 0 && uint32(len(value)) < length {
+		if visited[pageNo] {
+			return nil, fmt.Errorf("Overflow page loop at page %d.", pageNo)
+		}
+		visited[pageNo] = true
+		page, err := readBdbPage(r, pageSize, pageNo)
+		if err != nil {
+			return nil, err
+		}
+		header := parseBdbPageHeader(page, order)
+		if header.pageType != bdbOverflow {
+			return nil, fmt.Errorf("Unexpected page type %d of overflow page %d.", header.pageType, pageNo)
+		}
+		// number of used bytes of the last page is stored in the free offset field
+		end := len(page)
+		if header.nextPage == 0 {
+			end = bdbPageHeaderSize + int(header.freeOffset)
+		}
+		if end > len(page) {
+			return nil, fmt.Errorf("Invalid overflow page %d.", pageNo)
+		}
+		value = append(value, page[bdbPageHeaderSize:end]...)
+		pageNo = header.nextPage
+	}
+	if uint32(len(value)) < length {
+		return nil, fmt.Errorf("Truncated overflow value.")
+	}
+	return value[:length], nil
+}
+
+// readBdbHashValues returns all off-page values stored in Berkeley DB hash
+// database, which is how rpm stores package headers in the Packages file
+func readBdbHashValues(filename string) ([][]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	meta := make([]byte, 512)
+	if _, err := io.ReadFull(f, meta); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if order.Uint32(meta[12:16]) != bdbHashMagic {
+		order = binary.BigEndian
+		if order.Uint32(meta[12:16]) != bdbHashMagic {
+			return nil, fmt.Errorf("Not a Berkeley DB hash database.")
+		}
+	}
+	pageSize := order.Uint32(meta[20:24])
+	lastPage := order.Uint32(meta[32:36])
+	if pageSize < 512 || pageSize > 65536 {
+		return nil, fmt.Errorf("Invalid page size %d.", pageSize)
+	}
+
+	result := [][]byte{}
+	for pageNo := uint32(1); pageNo <= lastPage; pageNo++ {
+		page, err := readBdbPage(f, pageSize, pageNo)
+		if err != nil {
+			return nil, err
+		}
+		header := parseBdbPageHeader(page, order)
+		if header.pageType != bdbHash && header.pageType != bdbHashUnsorted {
+			continue
+		}
+		// entries are key and value pairs, only values are interesting
+		for i := 1; i < int(header.numEntries); i += 2 {
+			indexOffset := bdbPageHeaderSize + i*2
+			if indexOffset+2 > len(page) {
+				break
+			}
+			offset := int(order.Uint16(page[indexOffset:]))
+			if offset+bdbHashOffPageSize > len(page) || page[offset] != bdbHashOffPage {
+				continue
+			}
+			valuePage := order.Uint32(page[offset+4:])
+			length := order.Uint32(page[offset+8:])
+			value, err := readBdbOverflow(f, order, pageSize, valuePage, length)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, value)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,94 @@
+package packages
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// stanzas parses RFC 822 style paragraphs separated by empty lines as used in
+// dpkg status and apk installed files, continuation lines are ignored
+func stanzas(r io.Reader) ([]map[string]string, error) {
+	result := []map[string]string{}
+	current := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(current) > 0 {
+				result = append(result, current)
+				current = make(map[string]string)
+			}
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		idx := strings.Index(line, ":")
+		if idx < 1 {
+			continue
+		}
+		current[line[:idx]] = strings.TrimSpace(line[idx+1:])
+	}
+	if len(current) > 0 {
+		result = append(result, current)
+	}
+	return result, scanner.Err()
+}
+
+// splitDebianVersion splits [epoch:]upstream_version[-debian_revision]
+func splitDebianVersion(full string) (epoch string, version string, release string) {
+	version = full
+	if idx := strings.Index(version, ":"); idx > 0 {
+		epoch = version[:idx]
+		version = version[idx+1:]
+	}
+	if idx := strings.LastIndex(version, "-"); idx > 0 {
+		release = version[idx+1:]
+		version = version[:idx]
+	}
+	return epoch, version, release
+}
+
+func parseDpkg(r io.Reader) ([]pkg, error) {
+	paragraphs, err := stanzas(r)
+	if err != nil {
+		return nil, err
+	}
+	result := []pkg{}
+	for _, p := range paragraphs {
+		status := strings.Fields(p["Status"])
+		if len(status) != 3 || status[2] != "installed" {
+			continue
+		}
+		epoch, version, release := splitDebianVersion(p["Version"])
+		source := p["Source"]
+		if idx := strings.Index(source, " "); idx > 0 {
+			// binNMU source version in parentheses
+			source = source[:idx]
+		}
+		if source == "" {
+			source = p["Package"]
+		}
+		result = append(result, pkg{
+			name:    p["Package"],
+			epoch:   epoch,
+			version: version,
+			release: release,
+			arch:    p["Architecture"],
+			source:  source,
+		})
+	}
+	return result, nil
+}
+
+func readDpkg(filename string) ([]pkg, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseDpkg(f)
+}
@@ -0,0 +1,153 @@
+package packages
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	c "github.com/lzap/ufacter/facts/common"
+	"github.com/lzap/ufacter/lib/ufacter"
+)
+
+// Names limits reported packages, all packages are reported when empty
+var Names []string
+
+// pkg represents an installed package
+type pkg struct {
+	name    string
+	epoch   string
+	version string
+	release string
+	arch    string
+	source  string
+}
+
+// packageDatabase represents a package manager database on the filesystem
+type packageDatabase struct {
+	manager  string
+	filename string
+	read     func(filename string) ([]pkg, error)
+}
+
+// databases returns all known package databases, the first existing database
+// is used for each package manager
+func databases() []packageDatabase {
+	return []packageDatabase{
+		{"dpkg", c.HostPath("var", "lib", "dpkg", "status"), readDpkg},
+		{"apk", c.HostPath("lib", "apk", "db", "installed"), readApk},
+		{"rpm", c.HostPath("usr", "lib", "sysimage", "rpm", "rpmdb.sqlite"), readRpmSqlite},
+		{"rpm", c.HostPath("var", "lib", "rpm", "rpmdb.sqlite"), readRpmSqlite},
+		{"rpm", c.HostPath("usr", "lib", "sysimage", "rpm", "Packages"), readRpmBdb},
+		{"rpm", c.HostPath("var", "lib", "rpm", "Packages"), readRpmBdb},
+	}
+}
+
+// filter returns packages with names from the list, all packages are returned
+// for empty list
+func filter(pkgs []pkg, names []string) []pkg {
+	if len(names) == 0 {
+		return pkgs
+	}
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+	result := []pkg{}
+	for _, p := range pkgs {
+		if wanted[p.name] {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// packageKeys returns unique fact names for packages, packages installed for
+// multiple architectures are reported as "name:arch" like dpkg does and
+// packages installed in multiple versions of one architecture (e.g. rpm
+// install-only kernels or arch-less gpg-pubkey) as "name-version-release.arch"
+func packageKeys(pkgs []pkg) []string {
+	count := make(map[string]int)
+	for _, p := range pkgs {
+		count[p.name]++
+	}
+	keys := make([]string, len(pkgs))
+	for i, p := range pkgs {
+		keys[i] = p.name
+		if count[p.name] > 1 && p.arch != "" {
+			keys[i] = fmt.Sprintf("%s:%s", p.name, p.arch)
+		}
+	}
+	count = make(map[string]int)
+	for _, key := range keys {
+		count[key]++
+	}
+	for i, p := range pkgs {
+		if count[keys[i]] < 2 {
+			continue
+		}
+		keys[i] = p.name + "-" + p.version
+		if p.release != "" {
+			keys[i] += "-" + p.release
+		}
+		if p.arch != "" {
+			keys[i] += "." + p.arch
+		}
+	}
+	// identical entries of a damaged database
+	seen := make(map[string]int)
+	for i, key := range keys {
+		if seen[key]++; seen[key] > 1 {
+			keys[i] = fmt.Sprintf("%s#%d", key, seen[key])
+		}
+	}
+	return keys
+}
+
+func reportPackages(facts chan<- ufacter.Fact, manager string, pkgs []pkg) {
+	keys := packageKeys(pkgs)
+	for i, p := range pkgs {
+		value := map[string]string{
+			"version": p.version,
+			"manager": manager,
+		}
+		if p.epoch != "" && p.epoch != "0" {
+			value["epoch"] = p.epoch
+		}
+		if p.release != "" {
+			value["release"] = p.release
+		}
+		if p.arch != "" {
+			value["arch"] = p.arch
+		}
+		if p.source != "" {
+			value["source"] = p.source
+		}
+		facts <- ufacter.NewStableFactEx(value, "packages", keys[i])
+	}
+}
+
+// ReportFacts reads installed packages directly from package manager
+// databases without spawning any processes
+func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
+	start := time.Now()
+	defer ufacter.SendLastFact(facts)
+
+	found := make(map[string]bool)
+	for _, db := range databases() {
+		if found[db.manager] {
+			continue
+		}
+		if _, err := os.Stat(db.filename); err != nil {
+			continue
+		}
+		found[db.manager] = true
+		pkgs, err := db.read(db.filename)
+		if err != nil {
+			c.LogError(facts, err, "packages", db.manager)
+			continue
+		}
+		reportPackages(facts, db.manager, filter(pkgs, Names))
+	}
+
+	ufacter.SendVolatileFactEx(facts, time.Since(start), "ufacter", "stats", "packages")
+}
@@ -0,0 +1,407 @@
+package packages
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// rpmTag is a header entry used to build test header blobs
+type rpmTag struct {
+	tag   uint32
+	kind  uint32
+	value interface{}
+}
+
+// rpmHeaderBlob builds header blob in the format stored in rpm database
+func rpmHeaderBlob(tags []rpmTag) []byte {
+	index := []byte{}
+	data := []byte{}
+	for _, t := range tags {
+		offset := len(data)
+		switch v := t.value.(type) {
+		case string:
+			data = append(data, []byte(v)...)
+			data = append(data, 0)
+		case uint32:
+			for len(data)%4 != 0 {
+				data = append(data, 0)
+			}
+			offset = len(data)
+			data = append(data, 0, 0, 0, 0)
+			binary.BigEndian.PutUint32(data[offset:], v)
+		}
+		entry := make([]byte, rpmEntrySize)
+		binary.BigEndian.PutUint32(entry[0:], t.tag)
+		binary.BigEndian.PutUint32(entry[4:], t.kind)
+		binary.BigEndian.PutUint32(entry[8:], uint32(offset))
+		binary.BigEndian.PutUint32(entry[12:], 1)
+		index = append(index, entry...)
+	}
+	blob := make([]byte, 8)
+	binary.BigEndian.PutUint32(blob[0:], uint32(len(tags)))
+	binary.BigEndian.PutUint32(blob[4:], uint32(len(data)))
+	return append(append(blob, index...), data...)
+}
+
+func testRpmHeader(name string, padding int) []byte {
+	summary := "Summary"
+	for len(summary) < padding {
+		summary += " padding"
+	}
+	return rpmHeaderBlob([]rpmTag{
+		{rpmTagName, rpmTypeString, name},
+		{rpmTagVersion, rpmTypeString, "1.2.3"},
+		{rpmTagRelease, rpmTypeString, "4.el8"},
+		{rpmTagEpoch, rpmTypeInt32, uint32(2)},
+		{rpmTagArch, rpmTypeString, "x86_64"},
+		{rpmTagSourceRPM, rpmTypeString, name + "-1.2.3-4.el8.src.rpm"},
+		{1004, rpmTypeI18NString, summary},
+	})
+}
+
+func TestParseRpmHeader(t *testing.T) {
+	p, err := parseRpmHeader(testRpmHeader("bash", 0))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := pkg{"bash", "2", "1.2.3", "4.el8", "x86_64", "bash-1.2.3-4.el8.src.rpm"}
+	if *p != expected {
+		t.Fatalf("%v != %v", *p, expected)
+	}
+}
+
+func TestParseRpmHeaderInvalid(t *testing.T) {
+	if _, err := parseRpmHeader([]byte{0, 0, 0, 1}); err == nil {
+		t.Fatalf("expected error for short blob")
+	}
+	blob := testRpmHeader("bash", 0)
+	if _, err := parseRpmHeader(blob[:len(blob)-10]); err == nil {
+		t.Fatalf("expected error for truncated blob")
+	}
+}
+
+// writeBdbFixture writes little-endian Berkeley DB hash database with one hash
+// page and values stored in overflow pages
+func writeBdbFixture(filename string, values [][]byte) error {
+	const pageSize = 512
+	pages := [][]byte{make([]byte, pageSize), make([]byte, pageSize)}
+	newPage := func(pageType byte) []byte {
+		page := make([]byte, pageSize)
+		binary.LittleEndian.PutUint32(page[8:], uint32(len(pages)))
+		page[25] = pageType
+		pages = append(pages, page)
+		return page
+	}
+
+	hash := pages[1]
+	hash[25] = bdbHash
+	binary.LittleEndian.PutUint16(hash[20:], uint16(len(values)*2))
+	itemOffset := pageSize
+	for i, value := range values {
+		// key stored on page (H_KEYDATA)
+		itemOffset -= 5
+		hash[itemOffset] = 1
+		binary.LittleEndian.PutUint32(hash[itemOffset+1:], uint32(i+1))
+		binary.LittleEndian.PutUint16(hash[bdbPageHeaderSize+i*4:], uint16(itemOffset))
+
+		// value stored in overflow pages (H_OFFPAGE)
+		itemOffset -= bdbHashOffPageSize
+		hash[itemOffset] = bdbHashOffPage
+		binary.LittleEndian.PutUint32(hash[itemOffset+4:], uint32(len(pages)))
+		binary.LittleEndian.PutUint32(hash[itemOffset+8:], uint32(len(value)))
+		binary.LittleEndian.PutUint16(hash[bdbPageHeaderSize+i*4+2:], uint16(itemOffset))
+
+		for len(value) > 0 {
+			page := newPage(bdbOverflow)
+			n := copy(page[bdbPageHeaderSize:], value)
+			binary.LittleEndian.PutUint16(page[22:], uint16(n))
+			value = value[n:]
+			if len(value) > 0 {
+				binary.LittleEndian.PutUint32(page[16:], uint32(len(pages)))
+			}
+		}
+	}
+
+	meta := pages[0]
+	binary.LittleEndian.PutUint32(meta[12:], bdbHashMagic)
+	binary.LittleEndian.PutUint32(meta[20:], pageSize)
+	binary.LittleEndian.PutUint32(meta[32:], uint32(len(pages)-1))
+
+	contents := []byte{}
+	for _, page := range pages {
+		contents = append(contents, page...)
+	}
+	return ioutil.WriteFile(filename, contents, 0644)
+}
+
+func TestReadRpmBdb(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ufacter-bdb")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "Packages")
+	err = writeBdbFixture(filename, [][]byte{testRpmHeader("bash", 1500), testRpmHeader("zlib", 100)})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	pkgs, err := readRpmBdb(filename)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(pkgs) != 2 || pkgs[0].name != "bash" || pkgs[1].name != "zlib" {
+		t.Fatalf("unexpected packages %v", pkgs)
+	}
+	if pkgs[0].version != "1.2.3" || pkgs[0].release != "4.el8" || pkgs[0].arch != "x86_64" {
+		t.Fatalf("unexpected package %v", pkgs[0])
+	}
+}
+
+func TestReadRpmBdbCaptured(t *testing.T) {
+	// Packages of CentOS 5 container image written by rpm and Berkeley DB,
+	// from testdata of github.com/knqyf263/go-rpmdb (MIT, see LICENSE)
+	dir, err := ioutil.TempDir("", "ufacter-bdb")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	in, err := os.Open(filepath.Join("testdata", "bdb", "Packages.gz"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer in.Close()
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	filename := filepath.Join(dir, "Packages")
+	out, err := os.Create(filename)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := io.Copy(out, gz); err != nil {
+		t.Fatalf("%v", err)
+	}
+	out.Close()
+
+	pkgs, err := readRpmBdb(filename)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(pkgs) != 110 {
+		t.Fatalf("expected 110 packages, got %v", len(pkgs))
+	}
+	expected := map[int]pkg{
+		0:   {"setup", "", "2.5.58", "9.el5", "noarch", "setup-2.5.58-9.el5.src.rpm"},
+		4:   {"glibc", "", "2.5", "123.el5_11.3", "x86_64", "glibc-2.5-123.el5_11.3.src.rpm"},
+		109: {"libselinux-utils", "", "1.33.4", "5.7.el5.centos", "x86_64", "libselinux-1.33.4-5.7.el5.centos.src.rpm"},
+	}
+	for i, p := range expected {
+		if pkgs[i] != p {
+			t.Fatalf("%v != %v", pkgs[i], p)
+		}
+	}
+	epochs := map[string]string{}
+	for _, p := range pkgs {
+		if p.epoch != "" {
+			epochs[p.name] = p.epoch
+		}
+	}
+	if epochs["centos-release"] != "10" || epochs["tar"] != "2" || epochs["bind-libs"] != "30" {
+		t.Fatalf("unexpected epochs %v", epochs)
+	}
+}
+
+func TestReadRpmSqlite(t *testing.T) {
+	// created by sqlite3 with page size 512 to exercise interior and overflow
+	// pages, schema of the Packages table is the same as rpm 4.16 uses
+	pkgs, err := readRpmSqlite(filepath.Join("testdata", "rpmdb.sqlite"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(pkgs) != 24 {
+		t.Fatalf("expected 24 packages, got %v", len(pkgs))
+	}
+	expected := []pkg{
+		{"bash", "", "5.1.8", "6.el9", "x86_64", "bash-5.1.8-6.el9.src.rpm"},
+		{"openssl", "1", "3.0.7", "16.el9", "x86_64", "openssl-3.0.7-16.el9.src.rpm"},
+		{"glibc", "", "2.34", "60.el9", "i686", "glibc-2.34-60.el9.src.rpm"},
+		{"glibc", "", "2.34", "60.el9", "x86_64", "glibc-2.34-60.el9.src.rpm"},
+	}
+	if !reflect.DeepEqual(pkgs[:4], expected) {
+		t.Fatalf("%v != %v", pkgs[:4], expected)
+	}
+	if pkgs[23].name != "pkg23" || pkgs[23].version != "1.23" {
+		t.Fatalf("unexpected last package %v", pkgs[23])
+	}
+}
+
+// copyFixture copies files from testdata directory into temporary directory
+func copyFixture(t *testing.T, dir string, names ...string) string {
+	tmp, err := ioutil.TempDir("", "ufacter-sqlite")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for _, name := range names {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", dir, name))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(tmp, name), data, 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	return tmp
+}
+
+func TestReadRpmSqliteWal(t *testing.T) {
+	// copied while sqlite3 held the database open in WAL mode: a committed
+	// transaction removed bash and added podman, buildah was added by the last
+	// transaction, nothing was checkpointed
+	pkgs, err := readRpmSqlite(filepath.Join("testdata", "wal", "rpmdb.sqlite"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(pkgs) != 25 {
+		t.Fatalf("expected 25 packages, got %v", len(pkgs))
+	}
+	if pkgs[0].name != "openssl" || pkgs[23].name != "podman" || pkgs[24].name != "buildah" {
+		t.Fatalf("unexpected packages %v", pkgs)
+	}
+
+	// torn write of the log, only the uncommitted first frame survived
+	dir := copyFixture(t, "wal", "rpmdb.sqlite", "rpmdb.sqlite-wal")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "rpmdb.sqlite")
+	if err := os.Truncate(filename+"-wal", sqliteWalHeaderSize+sqliteWalFrameHeaderSize+512+100); err != nil {
+		t.Fatalf("%v", err)
+	}
+	pkgs, err = readRpmSqlite(filename)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(pkgs) != 24 || pkgs[0].name != "bash" {
+		t.Fatalf("unexpected packages %v", pkgs)
+	}
+}
+
+func TestReadRpmSqliteCorrupt(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "rpmdb.sqlite"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	dir, err := ioutil.TempDir("", "ufacter-sqlite")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	corruptions := map[string]func([]byte) []byte{
+		// cell count of the schema page beyond the page
+		"cells": func(b []byte) []byte {
+			binary.BigEndian.PutUint16(b[sqliteHeaderSize+3:], 0xFFFF)
+			return b
+		},
+		// negative payload size of the first schema cell
+		"size": func(b []byte) []byte {
+			offset := int(binary.BigEndian.Uint16(b[sqliteHeaderSize+8:]))
+			copy(b[offset:], []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+			return b
+		},
+		"truncated": func(b []byte) []byte {
+			return b[:3*512+17]
+		},
+	}
+	for name, corrupt := range corruptions {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, corrupt(append([]byte{}, data...)), 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+		if _, err := readRpmSqlite(filename); err == nil {
+			t.Fatalf("expected error for %s database", name)
+		}
+	}
+}
+
+func TestReadDpkg(t *testing.T) {
+	pkgs, err := readDpkg(filepath.Join("testdata", "status"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := []pkg{
+		{"bash", "", "5.1", "2+deb11u1", "amd64", "bash"},
+		{"libc6", "", "2.31", "13+deb11u5", "amd64", "glibc"},
+		{"libc6", "", "2.31", "13+deb11u5", "i386", "glibc"},
+		{"openssh-client", "1", "8.4p1", "5+deb11u1", "amd64", "openssh"},
+		{"libzstd1", "", "1.4.8+dfsg", "2.1+b1", "amd64", "libzstd"},
+	}
+	if !reflect.DeepEqual(pkgs, expected) {
+		t.Fatalf("%v != %v", pkgs, expected)
+	}
+}
+
+func TestReadApk(t *testing.T) {
+	pkgs, err := readApk(filepath.Join("testdata", "installed"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := []pkg{
+		{"musl", "", "1.2.4", "r1", "x86_64", "musl"},
+		{"busybox", "", "1.36.1", "r2", "x86_64", "busybox"},
+		{"libcrypto3", "", "3.1.2", "r0", "x86_64", "openssl"},
+	}
+	if !reflect.DeepEqual(pkgs, expected) {
+		t.Fatalf("%v != %v", pkgs, expected)
+	}
+}
+
+func TestFilterAndKeys(t *testing.T) {
+	pkgs, err := readDpkg(filepath.Join("testdata", "status"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	filtered := filter(pkgs, []string{"libc6", "bash", "missing"})
+	keys := packageKeys(filtered)
+	expected := []string{"bash", "libc6:amd64", "libc6:i386"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("%v != %v", keys, expected)
+	}
+	if len(filter(pkgs, nil)) != len(pkgs) {
+		t.Fatalf("empty filter must return all packages")
+	}
+}
+
+func TestPackageKeysRpm(t *testing.T) {
+	pkgs := []pkg{
+		{name: "kernel", version: "5.14.0", release: "362.8.1.el9", arch: "x86_64"},
+		{name: "kernel", version: "5.14.0", release: "378.el9", arch: "x86_64"},
+		{name: "kernel", version: "5.14.0", release: "388.el9", arch: "x86_64"},
+		{name: "glibc", version: "2.34", release: "83.el9", arch: "x86_64"},
+		{name: "glibc", version: "2.34", release: "83.el9", arch: "i686"},
+		{name: "gpg-pubkey", version: "8483c65d", release: "5ccc5b19"},
+		{name: "gpg-pubkey", version: "fd431d51", release: "4ae0493b"},
+		{name: "gpg-pubkey", version: "fd431d51", release: "4ae0493b"},
+		{name: "bash", version: "5.1.8", release: "6.el9", arch: "x86_64"},
+	}
+	keys := packageKeys(pkgs)
+	expected := []string{
+		"kernel-5.14.0-362.8.1.el9.x86_64",
+		"kernel-5.14.0-378.el9.x86_64",
+		"kernel-5.14.0-388.el9.x86_64",
+		"glibc:x86_64",
+		"glibc:i686",
+		"gpg-pubkey-8483c65d-5ccc5b19",
+		"gpg-pubkey-fd431d51-4ae0493b",
+		"gpg-pubkey-fd431d51-4ae0493b#2",
+		"bash",
+	}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("%v != %v", keys, expected)
+	}
+}
@@ -0,0 +1,116 @@
+package packages
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// rpm header tags and types, see rpmtag.h
+const (
+	rpmTagName      = 1000
+	rpmTagVersion   = 1001
+	rpmTagRelease   = 1002
+	rpmTagEpoch     = 1003
+	rpmTagArch      = 1022
+	rpmTagSourceRPM = 1044
+
+	rpmTypeInt32       = 4
+	rpmTypeString      = 6
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// rpm header index entry size in bytes
+const rpmEntrySize = 16
+
+// parseRpmHeader parses header blob as stored in the rpm database, the blob
+// is a header without the lead and magic: index length, data length, index
+// entries and data store
+func parseRpmHeader(blob []byte) (*pkg, error) {
+	if len(blob) < 8 {
+		return nil, fmt.Errorf("Header blob too short.")
+	}
+	il := int(binary.BigEndian.Uint32(blob[0:4]))
+	dl := int(binary.BigEndian.Uint32(blob[4:8]))
+	dataStart := 8 + il*rpmEntrySize
+	if il < 0 || dl < 0 || dataStart+dl > len(blob) {
+		return nil, fmt.Errorf("Header blob with invalid length.")
+	}
+	data := blob[dataStart : dataStart+dl]
+
+	result := &pkg{}
+	for i := 0; i < il; i++ {
+		entry := blob[8+i*rpmEntrySize:]
+		tag := binary.BigEndian.Uint32(entry[0:4])
+		kind := binary.BigEndian.Uint32(entry[4:8])
+		offset := int(int32(binary.BigEndian.Uint32(entry[8:12])))
+		if offset < 0 || offset >= len(data) {
+			continue
+		}
+		var value string
+		switch kind {
+		case rpmTypeString, rpmTypeStringArray, rpmTypeI18NString:
+			end := bytes.IndexByte(data[offset:], 0)
+			if end < 0 {
+				return nil, fmt.Errorf("Unterminated string in header tag %d.", tag)
+			}
+			value = string(data[offset : offset+end])
+		case rpmTypeInt32:
+			if offset+4 > len(data) {
+				return nil, fmt.Errorf("Invalid integer in header tag %d.", tag)
+			}
+			value = strconv.FormatUint(uint64(binary.BigEndian.Uint32(data[offset:])), 10)
+		default:
+			continue
+		}
+		switch tag {
+		case rpmTagName:
+			result.name = value
+		case rpmTagVersion:
+			result.version = value
+		case rpmTagRelease:
+			result.release = value
+		case rpmTagEpoch:
+			result.epoch = value
+		case rpmTagArch:
+			result.arch = value
+		case rpmTagSourceRPM:
+			result.source = value
+		}
+	}
+	if result.name == "" {
+		return nil, fmt.Errorf("Header without package name.")
+	}
+	return result, nil
+}
+
+// parseRpmHeaders parses list of header blobs
+func parseRpmHeaders(blobs [][]byte) ([]pkg, error) {
+	result := []pkg{}
+	for _, blob := range blobs {
+		p, err := parseRpmHeader(blob)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *p)
+	}
+	return result, nil
+}
+
+func readRpmSqlite(filename string) ([]pkg, error) {
+	blobs, err := readSqliteBlobs(filename, "Packages", 1)
+	if err != nil {
+		return nil, err
+	}
+	return parseRpmHeaders(blobs)
+}
+
+func readRpmBdb(filename string) ([]pkg, error) {
+	blobs, err := readBdbHashValues(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parseRpmHeaders(blobs)
+}
@@ -0,0 +1,381 @@
+package packages
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// SQLite file format constants, see https://www.sqlite.org/fileformat.html
+const (
+	sqliteMagic         = "SQLite format 3\x00"
+	sqliteHeaderSize    = 100
+	sqliteInteriorTable = 0x05
+	sqliteLeafTable     = 0x0D
+	sqliteMaxDepth      = 64
+
+	sqliteWalMagic           = 0x377f0682
+	sqliteWalHeaderSize      = 32
+	sqliteWalFrameHeaderSize = 24
+)
+
+// sqliteDB is a minimal read-only SQLite reader able to scan table b-trees,
+// committed pages of the write-ahead log take precedence over the database
+// file, rollback journal is not considered
+type sqliteDB struct {
+	r          io.ReaderAt
+	pageSize   int
+	usableSize int
+	wal        io.ReaderAt
+	walPages   map[int]int64
+}
+
+// varint decodes SQLite variable-length integer
+func varint(buf []byte) (int64, int) {
+	var v uint64
+	for i := 0; i < 8 && i < len(buf); i++ {
+		v = (v << 7) | uint64(buf[i]&0x7F)
+		if buf[i]&0x80 == 0 {
+			return int64(v), i + 1
+		}
+	}
+	if len(buf) < 9 {
+		return 0, 0
+	}
+	return int64((v << 8) | uint64(buf[8])), 9
+}
+
+func (db *sqliteDB) page(pageNo int) ([]byte, error) {
+	if pageNo < 1 {
+		return nil, fmt.Errorf("Invalid page number %d.", pageNo)
+	}
+	page := make([]byte, db.pageSize)
+	if offset, ok := db.walPages[pageNo]; ok {
+		if _, err := db.wal.ReadAt(page, offset); err != nil {
+			return nil, err
+		}
+		return page, nil
+	}
+	if _, err := db.r.ReadAt(page, int64(pageNo-1)*int64(db.pageSize)); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// walChecksum continues WAL checksum over data
+func walChecksum(order binary.ByteOrder, data []byte, s0 uint32, s1 uint32) (uint32, uint32) {
+	for i := 0; i+8 <= len(data); i += 8 {
+		s0 += order.Uint32(data[i:]) + s1
+		s1 += order.Uint32(data[i+4:]) + s0
+	}
+	return s0, s1
+}
+
+// readWal finds offsets of the latest committed version of pages in WAL
+// file, frames after the first invalid one and uncommitted frames are ignored
+// the same way SQLite recovers the log
+func (db *sqliteDB) readWal(r io.ReaderAt, size int64) error {
+	db.wal = r
+	db.walPages = make(map[int]int64)
+	if size < sqliteWalHeaderSize {
+		return nil
+	}
+	header := make([]byte, sqliteWalHeaderSize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return err
+	}
+	magic := binary.BigEndian.Uint32(header[0:4])
+	if magic&^1 != sqliteWalMagic {
+		return fmt.Errorf("Invalid WAL header.")
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if magic&1 != 0 {
+		order = binary.BigEndian
+	}
+	if pageSize := int(binary.BigEndian.Uint32(header[8:12])); pageSize != db.pageSize {
+		return fmt.Errorf("WAL page size %d differs from database page size %d.", pageSize, db.pageSize)
+	}
+	s0, s1 := walChecksum(order, header[0:24], 0, 0)
+	if s0 != binary.BigEndian.Uint32(header[24:28]) || s1 != binary.BigEndian.Uint32(header[28:32]) {
+		// log was reset and not written since
+		return nil
+	}
+
+	frame := make([]byte, sqliteWalFrameHeaderSize+db.pageSize)
+	pending := make(map[int]int64)
+	for offset := int64(sqliteWalHeaderSize); offset+int64(len(frame)) <= size; offset += int64(len(frame)) {
+		if _, err := r.ReadAt(frame, offset); err != nil {
+			return err
+		}
+		if !bytes.Equal(frame[8:16], header[16:24]) {
+			break
+		}
+		s0, s1 = walChecksum(order, frame[0:8], s0, s1)
+		s0, s1 = walChecksum(order, frame[sqliteWalFrameHeaderSize:], s0, s1)
+		if s0 != binary.BigEndian.Uint32(frame[16:20]) || s1 != binary.BigEndian.Uint32(frame[20:24]) {
+			break
+		}
+		pending[int(binary.BigEndian.Uint32(frame[0:4]))] = offset + sqliteWalFrameHeaderSize
+		if binary.BigEndian.Uint32(frame[4:8]) != 0 {
+			// commit frame
+			for pageNo, pageOffset := range pending {
+				db.walPages[pageNo] = pageOffset
+			}
+			pending = make(map[int]int64)
+		}
+	}
+	return nil
+}
+
+// payload returns complete payload of a table leaf cell following overflow
+// pages when needed
+func (db *sqliteDB) payload(page []byte, offset int, size int) ([]byte, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("Invalid cell payload size.")
+	}
+	u := db.usableSize
+	maxLocal := u - 35
+	local := size
+	if size > maxLocal {
+		minLocal := ((u-12)*32)/255 - 23
+		local = minLocal + (size-minLocal)%(u-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+	if offset+local > len(page) {
+		return nil, fmt.Errorf("Cell payload out of page bounds.")
+	}
+	result := append([]byte{}, page[offset:offset+local]...)
+	if local == size {
+		return result, nil
+	}
+	if offset+local+4 > len(page) {
+		return nil, fmt.Errorf("Cell overflow pointer out of page bounds.")
+	}
+	next := int(binary.BigEndian.Uint32(page[offset+local:]))
+	visited := make(map[int]bool)
+	for next != 0 && len(result) < size {
+		if visited[next] {
+			return nil, fmt.Errorf("Overflow page loop at page %d.", next)
+		}
+		visited[next] = true
+		overflow, err := db.page(next)
+		if err != nil {
+			return nil, err
+		}
+		next = int(binary.BigEndian.Uint32(overflow[0:4]))
+		chunk := overflow[4:u]
+		if remaining := size - len(result); len(chunk) > remaining {
+			chunk = chunk[:remaining]
+		}
+		result = append(result, chunk...)
+	}
+	if len(result) < size {
+		return nil, fmt.Errorf("Truncated overflow payload.")
+	}
+	return result, nil
+}
+
+// scan calls function for payload of each row of table b-tree
+func (db *sqliteDB) scan(pageNo int, depth int, fn func(record []byte) error) error {
+	if depth > sqliteMaxDepth {
+		return fmt.Errorf("B-tree too deep.")
+	}
+	page, err := db.page(pageNo)
+	if err != nil {
+		return err
+	}
+	header := page
+	if pageNo == 1 {
+		header = page[sqliteHeaderSize:]
+	}
+	cells := int(binary.BigEndian.Uint16(header[3:5]))
+	pointers := 8
+	if header[0] == sqliteInteriorTable {
+		pointers = 12
+	}
+	if pointers+cells*2 > len(header) {
+		return fmt.Errorf("Cell pointer array out of page bounds.")
+	}
+	switch header[0] {
+	case sqliteInteriorTable:
+		for i := 0; i < cells; i++ {
+			offset := int(binary.BigEndian.Uint16(header[12+i*2:]))
+			if offset+4 > len(page) {
+				return fmt.Errorf("Cell out of page bounds.")
+			}
+			if err := db.scan(int(binary.BigEndian.Uint32(page[offset:])), depth+1, fn); err != nil {
+				return err
+			}
+		}
+		return db.scan(int(binary.BigEndian.Uint32(header[8:12])), depth+1, fn)
+	case sqliteLeafTable:
+		for i := 0; i < cells; i++ {
+			offset := int(binary.BigEndian.Uint16(header[8+i*2:]))
+			if offset >= len(page) {
+				return fmt.Errorf("Cell out of page bounds.")
+			}
+			size, n := varint(page[offset:])
+			if n == 0 || offset+n >= len(page) {
+				return fmt.Errorf("Invalid cell header.")
+			}
+			offset += n
+			_, n = varint(page[offset:])
+			if n == 0 {
+				return fmt.Errorf("Invalid cell header.")
+			}
+			offset += n
+			record, err := db.payload(page, offset, int(size))
+			if err != nil {
+				return err
+			}
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("Unexpected b-tree page type %d.", header[0])
+}
+
+// column returns value of a column from a record, integers are returned as
+// int64, text as string and blobs as []byte
+func column(record []byte, idx int) (interface{}, error) {
+	headerSize, n := varint(record)
+	if headerSize > int64(len(record)) || n == 0 {
+		return nil, fmt.Errorf("Invalid record header.")
+	}
+	pos := n
+	dataOffset := int(headerSize)
+	for col := 0; pos < int(headerSize); col++ {
+		serial, n := varint(record[pos:])
+		if n == 0 {
+			return nil, fmt.Errorf("Invalid record header.")
+		}
+		pos += n
+		var size int
+		switch {
+		case serial >= 12 && serial%2 == 0:
+			size = int(serial-12) / 2
+		case serial >= 13:
+			size = int(serial-13) / 2
+		case serial == 5:
+			size = 6
+		case serial == 6 || serial == 7:
+			size = 8
+		case serial >= 1 && serial <= 4:
+			size = int(serial)
+		}
+		if dataOffset+size > len(record) {
+			return nil, fmt.Errorf("Record value out of bounds.")
+		}
+		if col != idx {
+			dataOffset += size
+			continue
+		}
+		data := record[dataOffset : dataOffset+size]
+		switch {
+		case serial == 0 || serial == 7:
+			return nil, nil
+		case serial == 8:
+			return int64(0), nil
+		case serial == 9:
+			return int64(1), nil
+		case serial >= 12 && serial%2 == 0:
+			return data, nil
+		case serial >= 13:
+			return string(data), nil
+		}
+		var v int64
+		if size > 0 && data[0]&0x80 != 0 {
+			v = -1
+		}
+		for _, b := range data {
+			v = (v << 8) | int64(b)
+		}
+		return v, nil
+	}
+	return nil, nil
+}
+
+// readSqliteBlobs returns blob column of all rows of the table
+func readSqliteBlobs(filename string, table string, idx int) ([][]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header := make([]byte, sqliteHeaderSize)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(header[0:16], []byte(sqliteMagic)) {
+		return nil, fmt.Errorf("Not a SQLite database.")
+	}
+	db := &sqliteDB{r: f, pageSize: int(binary.BigEndian.Uint16(header[16:18]))}
+	if db.pageSize == 1 {
+		db.pageSize = 65536
+	}
+	db.usableSize = db.pageSize - int(header[20])
+	if db.pageSize < 512 || db.usableSize < 480 {
+		return nil, fmt.Errorf("Invalid page size %d.", db.pageSize)
+	}
+	// recent changes are in the log until the next checkpoint
+	wal, err := os.Open(filename + "-wal")
+	if err == nil {
+		defer wal.Close()
+		info, err := wal.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if err := db.readWal(wal, info.Size()); err != nil {
+			return nil, fmt.Errorf("%s-wal: %v", filename, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// sqlite_schema columns: type, name, tbl_name, rootpage, sql
+	rootPage := int64(0)
+	err = db.scan(1, 0, func(record []byte) error {
+		kind, err := column(record, 0)
+		if err != nil {
+			return err
+		}
+		name, err := column(record, 1)
+		if err != nil {
+			return err
+		}
+		if kind == "table" && name == table {
+			root, err := column(record, 3)
+			if err != nil {
+				return err
+			}
+			rootPage, _ = root.(int64)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rootPage == 0 {
+		return nil, fmt.Errorf("Table %s not found.", table)
+	}
+
+	result := [][]byte{}
+	err = db.scan(int(rootPage), 0, func(record []byte) error {
+		value, err := column(record, idx)
+		if err != nil {
+			return err
+		}
+		if blob, ok := value.([]byte); ok {
+			result = append(result, blob)
+		}
+		return nil
+	})
+	return result, err
+}
@@ -1,97 +1,132 @@
 package route
 
 import (
+	"errors"
+	"fmt"
 	"net"
+	"syscall"
 	"time"
 
 	c "github.com/lzap/ufacter/facts/common"
+	"github.com/lzap/ufacter/facts/rtnl"
 	"github.com/lzap/ufacter/lib/ufacter"
-	s "github.com/shirou/gopsutil/net"
 	n "github.com/vishvananda/netlink"
 )
 
-// ReportFacts adds route information
-func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
-	start := time.Now()
-	defer ufacter.SendLastFact(facts)
+// handle is replaced by a fake in tests
+var handle = rtnl.Netlink()
 
-	var primaryIPv4MAC string
-	var primaryIPv6MAC string
+// family describes facts of one address family of the primary interface,
+// names with native flag set are known to the original facter
+type family struct {
+	family      int
+	destination string
+	primary     string
+	mac         string
+	mtu         string
+	cidr        string
+	ip          string
+	network     string
+	netmask     string
+	bindings    string
+	native      bool
+	mask        func(net.IPMask) string
+}
 
-	// primary IPv4 interface
-	defaultRoutes, err := n.RouteGet(net.ParseIP("1.0.0.0"))
-	if err == nil && len(defaultRoutes) > 0 {
-		primaryLink, err := n.LinkByIndex(defaultRoutes[0].LinkIndex)
-		if err == nil {
-			primaryIPv4MAC = primaryLink.Attrs().HardwareAddr.String()
-			facts <- ufacter.NewStableFact(primaryLink.Attrs().Name, "networking", "primary")
-			facts <- ufacter.NewStableFactEx(primaryLink.Attrs().HardwareAddr.String(), "networking", "primary_mac")
-		} else {
-			c.LogError(facts, err, "link", "link by index")
+var families = []family{
+	{n.FAMILY_V4, "1.0.0.0", "primary", "mac", "mtu", "cidr", "ip", "network", "netmask", "bindings", true, c.IPMaskToString4},
+	{n.FAMILY_V6, "100::", "primary6", "mac6", "mtu6", "cidr6", "ip6", "network6", "netmask6", "bindings6", false, c.IPMaskToString6},
+}
+
+// primaryAddress returns index of the route source address, or the first
+// global primary address, or the first address at all
+func primaryAddress(addrs []n.Addr, src net.IP) int {
+	for i, addr := range addrs {
+		if src != nil && addr.IP.Equal(src) {
+			return i
 		}
-	} else {
-		c.LogError(facts, err, "link", "IPv4 netlink default route")
 	}
-
-	// primary IPv6 interface
-	defaultRoutes, err = n.RouteGet(net.ParseIP("100::"))
-	if err == nil && len(defaultRoutes) > 0 {
-		primaryLink, err := n.LinkByIndex(defaultRoutes[0].LinkIndex)
-		if err == nil {
-			primaryIPv6MAC = primaryLink.Attrs().HardwareAddr.String()
-			facts <- ufacter.NewStableFact(primaryLink.Attrs().Name, "networking", "primary6")
-			facts <- ufacter.NewStableFactEx(primaryLink.Attrs().HardwareAddr.String(), "networking", "primary6_mac")
-		} else {
-			c.LogError(facts, err, "link", "link by index")
+	for i, addr := range addrs {
+		if addr.Flags&syscall.IFA_F_SECONDARY == 0 && addr.Scope == int(n.SCOPE_UNIVERSE) {
+			return i
 		}
-	} else {
-		c.LogError(facts, err, "link", "IPv6 netlink default route")
 	}
+	if len(addrs) > 0 {
+		return 0
+	}
+	return -1
+}
 
-	// networking.(mac,mtu,ip,ip6,netmask,netmask6,network,network6) + (mac6,mtu6) extended
-	netIfaces, err := s.Interfaces()
-	if err == nil {
-		for _, v := range netIfaces {
-			if primaryIPv4MAC != "" && v.HardwareAddr == primaryIPv4MAC {
-				// IPv4
-				facts <- ufacter.NewStableFact(v.HardwareAddr, "networking", "mac")
-				facts <- ufacter.NewStableFact(v.MTU, "networking", "mtu")
+// newFact returns native or extended fact
+func newFact(value interface{}, native bool, names ...string) ufacter.Fact {
+	if native {
+		return ufacter.NewStableFact(value, names...)
+	}
+	return ufacter.NewStableFactEx(value, names...)
+}
 
-				for _, ipAddr := range v.Addrs {
-					parsedIP, parsedNet, err := net.ParseCIDR(ipAddr.Addr)
-					if err != nil {
-						c.LogError(facts, err, "route", "parse CIDR")
-						continue
-					}
-					if ip4 := parsedIP.To4(); ip4 != nil {
-						facts <- ufacter.NewStableFactEx(ipAddr.Addr, "networking", "cidr")
-						facts <- ufacter.NewStableFact(parsedIP.String(), "networking", "ip")
-						facts <- ufacter.NewStableFact(parsedNet.IP.String(), "networking", "network")
-						facts <- ufacter.NewStableFact(c.IPMaskToString4(parsedNet.Mask), "networking", "netmask")
-					}
-				}
-			} else if primaryIPv6MAC != "" && v.HardwareAddr == primaryIPv6MAC {
-				// IPv6
-				facts <- ufacter.NewStableFactEx(v.HardwareAddr, "networking", "mac6")
-				facts <- ufacter.NewStableFactEx(v.MTU, "networking", "mtu6")
+// reportPrimary sends facts of the interface used for the default route
+func reportPrimary(facts chan<- ufacter.Fact, h rtnl.Handle, snap *rtnl.Snapshot, f family, extended bool) {
+	routes, err := h.RouteGet(net.ParseIP(f.destination))
+	if err == nil && len(routes) == 0 {
+		err = errors.New("no route")
+	}
+	if err != nil {
+		c.LogError(facts, err, "route", f.primary, "netlink default route")
+		return
+	}
+	link, ok := snap.ByIndex(routes[0].LinkIndex)
+	if !ok {
+		c.LogError(facts, fmt.Errorf("link %d not found", routes[0].LinkIndex), "route", f.primary, "link by index")
+		return
+	}
+	attrs := link.Attrs()
+	facts <- ufacter.NewStableFact(attrs.Name, "networking", f.primary)
+	facts <- ufacter.NewStableFactEx(attrs.HardwareAddr.String(), "networking", f.primary+"_mac")
+	facts <- newFact(attrs.HardwareAddr.String(), f.native, "networking", f.mac)
+	facts <- newFact(attrs.MTU, f.native, "networking", f.mtu)
 
-				for _, ipAddr := range v.Addrs {
-					parsedIP, parsedNet, err := net.ParseCIDR(ipAddr.Addr)
-					if err != nil {
-						c.LogError(facts, err, "route", "parse CIDR")
-						continue
-					}
-					if ip4 := parsedIP.To4(); ip4 == nil {
-						facts <- ufacter.NewStableFactEx(ipAddr.Addr, "networking", "cidr6")
-						facts <- ufacter.NewStableFact(parsedIP.String(), "networking", "ip6")
-						facts <- ufacter.NewStableFact(parsedNet.IP.String(), "networking", "network6")
-						facts <- ufacter.NewStableFact(c.IPMaskToString4(parsedNet.Mask), "networking", "netmask6")
-					}
-				}
-			}
-		}
+	addrs, err := h.AddrList(link, f.family)
+	if err != nil {
+		c.LogError(facts, err, "route", f.primary, "address list")
+		return
+	}
+	bindings := make([]map[string]string, 0)
+	for _, addr := range addrs {
+		bindings = append(bindings, c.Binding(addr.IPNet, extended))
+	}
+	facts <- ufacter.NewStableFactEx(bindings, "networking", "primary_bindings", f.bindings)
+
+	if i := primaryAddress(addrs, routes[0].Src); i >= 0 {
+		addr := addrs[i].IPNet
+		facts <- ufacter.NewStableFactEx(addr.String(), "networking", f.cidr)
+		facts <- ufacter.NewStableFact(addr.IP.String(), "networking", f.ip)
+		facts <- ufacter.NewStableFact(addr.IP.Mask(addr.Mask).String(), "networking", f.network)
+		facts <- ufacter.NewStableFact(f.mask(addr.Mask), "networking", f.netmask)
+	}
+}
+
+// ReportPrimary sends facts of interfaces used for IPv4 and IPv6 default
+// routes of links in snapshot taken via h
+func ReportPrimary(facts chan<- ufacter.Fact, h rtnl.Handle, snap *rtnl.Snapshot, extended bool) {
+	for _, f := range families {
+		reportPrimary(facts, h, snap, f, extended)
+	}
+}
+
+// ReportFacts adds route information
+func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
+	start := time.Now()
+	defer ufacter.SendLastFact(facts)
+	if c.SkipOffline(facts, "route") {
+		return
+	}
+
+	snap, err := rtnl.TakeSnapshot(handle)
+	if err == nil {
+		ReportPrimary(facts, handle, snap, extended)
 	} else {
-		c.LogError(facts, err, "route", "interfaces")
+		c.LogError(facts, err, "route", "link list")
 	}
 
 	ufacter.SendVolatileFactEx(facts, time.Since(start), "ufacter", "stats", "route")
@@ -0,0 +1,111 @@
+package route
+
+import (
+	"net"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/lzap/ufacter/facts/rtnl"
+	"github.com/lzap/ufacter/lib/ufacter"
+	n "github.com/vishvananda/netlink"
+)
+
+func addr(t *testing.T, cidr string, flags int, scope n.Scope) n.Addr {
+	ip, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	ipnet.IP = ip
+	return n.Addr{IPNet: ipnet, Flags: flags, Scope: int(scope)}
+}
+
+// collect runs the module against fake netlink and returns facts keyed by
+// dotted name
+func collect(fake rtnl.Handle) map[string]interface{} {
+	previous := handle
+	handle = fake
+	defer func() { handle = previous }()
+
+	ch := make(chan ufacter.Fact, 1024)
+	ReportFacts(ch, true, true)
+	close(ch)
+	result := make(map[string]interface{})
+	for f := range ch {
+		if f.Name != nil && f.Value != nil && f.Value != "" && f.NameDots() != "ufacter.stats.route" {
+			result[f.NameDots()] = f.Value
+		}
+	}
+	return result
+}
+
+func TestReportPrimary(t *testing.T) {
+	// bond and its VLAN share the MAC address, the VLAN has the default route
+	fake, err := rtnl.LoadFake(filepath.Join("testdata", "netlink.json"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	result := collect(fake)
+	expected := map[string]interface{}{
+		"networking.primary":      "bond0.10",
+		"networking.primary_mac":  "52:54:00:aa:bb:cc",
+		"networking.mac":          "52:54:00:aa:bb:cc",
+		"networking.mtu":          9000,
+		"networking.cidr":         "192.0.2.20/24",
+		"networking.ip":           "192.0.2.20",
+		"networking.network":      "192.0.2.0",
+		"networking.netmask":      "255.255.255.0",
+		"networking.primary6":     "bond0.10",
+		"networking.primary6_mac": "52:54:00:aa:bb:cc",
+		"networking.mac6":         "52:54:00:aa:bb:cc",
+		"networking.mtu6":         9000,
+		"networking.cidr6":        "2001:db8::10/48",
+		"networking.ip6":          "2001:db8::10",
+		"networking.network6":     "2001:db8::",
+		"networking.netmask6":     "ffff:ffff:ffff::",
+		"networking.primary_bindings.bindings": []map[string]string{
+			{"cidr": "192.0.2.10/24", "address": "192.0.2.10", "network": "192.0.2.0", "netmask": "255.255.255.0"},
+			{"cidr": "192.0.2.20/24", "address": "192.0.2.20", "network": "192.0.2.0", "netmask": "255.255.255.0"},
+		},
+		"networking.primary_bindings.bindings6": []map[string]string{
+			{"cidr": "fe80::1/64", "address": "fe80::1", "network": "fe80::", "netmask": "ffff:ffff:ffff:ffff::"},
+			{"cidr": "2001:db8::10/48", "address": "2001:db8::10", "network": "2001:db8::", "netmask": "ffff:ffff:ffff::"},
+		},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+}
+
+func TestReportPrimaryUnreachable(t *testing.T) {
+	result := collect(&rtnl.Fake{})
+	for name := range result {
+		if name != "ufacter.errors.route.primary.netlink default route" &&
+			name != "ufacter.errors.route.primary6.netlink default route" {
+			t.Fatalf("unexpected fact %v", name)
+		}
+	}
+}
+
+type primaryAddressTPair struct {
+	addrs    []n.Addr
+	src      net.IP
+	expected int
+}
+
+func TestPrimaryAddress(t *testing.T) {
+	tests := []primaryAddressTPair{
+		{[]n.Addr{}, nil, -1},
+		{[]n.Addr{addr(t, "fe80::1/64", 0, n.SCOPE_LINK)}, nil, 0},
+		{[]n.Addr{addr(t, "fe80::1/64", 0, n.SCOPE_LINK), addr(t, "2001:db8::1/64", 0, n.SCOPE_UNIVERSE)}, nil, 1},
+		{[]n.Addr{addr(t, "10.0.0.2/8", syscall.IFA_F_SECONDARY, n.SCOPE_UNIVERSE), addr(t, "10.0.0.1/8", 0, n.SCOPE_UNIVERSE)}, nil, 1},
+		{[]n.Addr{addr(t, "10.0.0.1/8", 0, n.SCOPE_UNIVERSE), addr(t, "10.0.0.2/8", 0, n.SCOPE_UNIVERSE)}, net.ParseIP("10.0.0.2"), 1},
+	}
+	for _, pair := range tests {
+		result := primaryAddress(pair.addrs, pair.src)
+		if result != pair.expected {
+			t.Fatalf("%v != %v", result, pair.expected)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package rtnl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+
+	n "github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+// fakeLink is a link in fixture, type specific fields are used by the type
+type fakeLink struct {
+	Index     int    `json:"index"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	MAC       string `json:"mac"`
+	MTU       int    `json:"mtu"`
+	TxQLen    int    `json:"txqlen"`
+	Flags     uint32 `json:"flags"`
+	OperState string `json:"operstate"`
+	Parent    int    `json:"parent"`
+	Master    int    `json:"master"`
+	// bond mode, e.g. 802.3ad
+	Mode string `json:"mode"`
+	// VLAN id
+	VlanID int `json:"vlan_id"`
+	// veth peer name
+	Peer string `json:"peer"`
+	// counters, keys are names of netlink LinkStatistics fields
+	Stats *n.LinkStatistics `json:"stats"`
+	// names netlink Link does not carry
+	AltNames []string `json:"altnames"`
+	PermMAC  string   `json:"perm_mac"`
+}
+
+// fakeAddr is an address in fixture
+type fakeAddr struct {
+	Index int    `json:"index"`
+	CIDR  string `json:"cidr"`
+	Flags int    `json:"flags"`
+	Scope int    `json:"scope"`
+}
+
+// fakeRoute is a route in fixture, destination is CIDR or "default"
+type fakeRoute struct {
+	Index       int    `json:"index"`
+	Destination string `json:"destination"`
+	Gateway     string `json:"gateway"`
+	Source      string `json:"source"`
+	Metric      int    `json:"metric"`
+}
+
+// fakeVlan is a bridge VLAN entry in fixture
+type fakeVlan struct {
+	Vid   uint16 `json:"vid"`
+	Flags uint16 `json:"flags"`
+}
+
+type fixture struct {
+	Links  []fakeLink            `json:"links"`
+	Addrs  []fakeAddr            `json:"addrs"`
+	Routes []fakeRoute           `json:"routes"`
+	Vlans  map[string][]fakeVlan `json:"vlans"`
+}
+
+var operStates = map[string]n.LinkOperState{
+	"":                 n.OperUnknown,
+	"unknown":          n.OperUnknown,
+	"not-present":      n.OperNotPresent,
+	"down":             n.OperDown,
+	"lower-layer-down": n.OperLowerLayerDown,
+	"testing":          n.OperTesting,
+	"dormant":          n.OperDormant,
+	"up":               n.OperUp,
+}
+
+// Fake answers queries from links, addresses and routes of a JSON fixture
+type Fake struct {
+	links  []n.Link
+	names  map[int]LinkNames
+	addrs  map[int][]n.Addr
+	routes []n.Route
+	vlans  map[int32][]*nl.BridgeVlanInfo
+}
+
+func newLink(l fakeLink) (n.Link, error) {
+	state, ok := operStates[l.OperState]
+	if !ok {
+		return nil, fmt.Errorf("link %s: unknown operstate %s", l.Name, l.OperState)
+	}
+	attrs := n.LinkAttrs{
+		Index:       l.Index,
+		Name:        l.Name,
+		MTU:         l.MTU,
+		TxQLen:      l.TxQLen,
+		RawFlags:    l.Flags,
+		OperState:   state,
+		ParentIndex: l.Parent,
+		MasterIndex: l.Master,
+		Statistics:  l.Stats,
+	}
+	if l.MAC != "" {
+		mac, err := net.ParseMAC(l.MAC)
+		if err != nil {
+			return nil, fmt.Errorf("link %s: %v", l.Name, err)
+		}
+		attrs.HardwareAddr = mac
+	}
+	switch l.Type {
+	case "device":
+		return &n.Device{LinkAttrs: attrs}, nil
+	case "dummy":
+		return &n.Dummy{LinkAttrs: attrs}, nil
+	case "bridge":
+		return &n.Bridge{LinkAttrs: attrs}, nil
+	case "bond":
+		bond := n.NewLinkBond(attrs)
+		bond.Mode = n.StringToBondMode(l.Mode)
+		return bond, nil
+	case "vlan":
+		return &n.Vlan{LinkAttrs: attrs, VlanId: l.VlanID}, nil
+	case "veth":
+		return &n.Veth{LinkAttrs: attrs, PeerName: l.Peer}, nil
+	}
+	return &n.GenericLink{LinkAttrs: attrs, LinkType: l.Type}, nil
+}
+
+// parseIPNet returns address with network mask
+func parseIPNet(cidr string) (*net.IPNet, error) {
+	ip, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	ipnet.IP = ip
+	return ipnet, nil
+}
+
+// LoadFake returns fake handle with links, addresses, routes and bridge VLANs
+// from JSON fixture
+func LoadFake(filename string) (*Fake, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var fix fixture
+	if err := json.Unmarshal(data, &fix); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	f := &Fake{
+		names: make(map[int]LinkNames),
+		addrs: make(map[int][]n.Addr),
+		vlans: make(map[int32][]*nl.BridgeVlanInfo),
+	}
+	for _, l := range fix.Links {
+		link, err := newLink(l)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		f.links = append(f.links, link)
+		if l.AltNames != nil || l.PermMAC != "" {
+			f.names[l.Index] = LinkNames{AltNames: l.AltNames, PermMAC: l.PermMAC}
+		}
+	}
+	for _, a := range fix.Addrs {
+		ipnet, err := parseIPNet(a.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		f.addrs[a.Index] = append(f.addrs[a.Index], n.Addr{IPNet: ipnet, Flags: a.Flags, Scope: a.Scope})
+	}
+	for _, r := range fix.Routes {
+		route := n.Route{LinkIndex: r.Index, Priority: r.Metric, Gw: net.ParseIP(r.Gateway), Src: net.ParseIP(r.Source)}
+		if r.Destination != "default" {
+			if _, route.Dst, err = net.ParseCIDR(r.Destination); err != nil {
+				return nil, fmt.Errorf("%s: %v", filename, err)
+			}
+		}
+		f.routes = append(f.routes, route)
+	}
+	for index, list := range fix.Vlans {
+		i, err := strconv.Atoi(index)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		for _, v := range list {
+			f.vlans[int32(i)] = append(f.vlans[int32(i)], &nl.BridgeVlanInfo{Vid: v.Vid, Flags: v.Flags})
+		}
+	}
+	return f, nil
+}
+
+// LinkList returns links in fixture order and names of links which have them
+func (f *Fake) LinkList() ([]n.Link, map[int]LinkNames, error) {
+	return f.links, f.names, nil
+}
+
+// AddrList returns addresses of link or all links when link is nil
+func (f *Fake) AddrList(link n.Link, family int) ([]n.Addr, error) {
+	result := []n.Addr{}
+	for _, l := range f.links {
+		if link != nil && l.Attrs().Index != link.Attrs().Index {
+			continue
+		}
+		for _, addr := range f.addrs[l.Attrs().Index] {
+			if family == n.FAMILY_ALL || (family == n.FAMILY_V4) == (addr.IP.To4() != nil) {
+				result = append(result, addr)
+			}
+		}
+	}
+	return result, nil
+}
+
+// routeFamily returns address family of route
+func routeFamily(r n.Route) int {
+	ip := r.Gw
+	if r.Dst != nil {
+		ip = r.Dst.IP
+	} else if ip == nil {
+		ip = r.Src
+	}
+	if ip != nil && ip.To4() == nil {
+		return n.FAMILY_V6
+	}
+	return n.FAMILY_V4
+}
+
+// RouteGet returns the route with the longest prefix matching destination,
+// default routes match everything in their family
+func (f *Fake) RouteGet(destination net.IP) ([]n.Route, error) {
+	family := n.FAMILY_V4
+	if destination.To4() == nil {
+		family = n.FAMILY_V6
+	}
+	best := -1
+	bestLen := -1
+	for i, r := range f.routes {
+		if routeFamily(r) != family {
+			continue
+		}
+		length := 0
+		if r.Dst != nil {
+			if !r.Dst.Contains(destination) {
+				continue
+			}
+			length, _ = r.Dst.Mask.Size()
+		}
+		if length > bestLen || (length == bestLen && r.Priority < f.routes[best].Priority) {
+			best, bestLen = i, length
+		}
+	}
+	if best < 0 {
+		return nil, errors.New("network is unreachable")
+	}
+	return []n.Route{f.routes[best]}, nil
+}
+
+// RouteList returns routes of link or all links when link is nil
+func (f *Fake) RouteList(link n.Link, family int) ([]n.Route, error) {
+	result := []n.Route{}
+	for _, r := range f.routes {
+		if link != nil && r.LinkIndex != link.Attrs().Index {
+			continue
+		}
+		if family == n.FAMILY_ALL || routeFamily(r) == family {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+// BridgeVlanList returns bridge VLANs by link index
+func (f *Fake) BridgeVlanList() (map[int32][]*nl.BridgeVlanInfo, error) {
+	return f.vlans, nil
+}
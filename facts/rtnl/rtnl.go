@@ -0,0 +1,174 @@
+package rtnl
+
+import (
+	"net"
+	"syscall"
+
+	n "github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+	ns "github.com/vishvananda/netns"
+)
+
+// rtnetlink attributes missing in syscall, see include/uapi/linux/if_link.h
+const (
+	iflaExtMask     = 29
+	iflaPropList    = 52
+	iflaAltIfname   = 53
+	iflaPermAddress = 54
+	nlaTypeMask     = 0x3fff
+)
+
+// LinkNames are alternative names and permanent address of a link, neither
+// is available in netlink Link
+type LinkNames struct {
+	AltNames []string
+	PermMAC  string
+}
+
+// Handle queries links, addresses and routes, Netlink implements it and Fake
+// replaces it in tests
+type Handle interface {
+	// LinkList returns links and their names by link index from one dump
+	LinkList() ([]n.Link, map[int]LinkNames, error)
+	AddrList(link n.Link, family int) ([]n.Addr, error)
+	RouteGet(destination net.IP) ([]n.Route, error)
+	RouteList(link n.Link, family int) ([]n.Route, error)
+	BridgeVlanList() (map[int32][]*nl.BridgeVlanInfo, error)
+}
+
+// NetlinkHandle is netlink Handle which also reads names of links, the link
+// dump is sent via its own socket as netlink Handle sockets are not exported
+type NetlinkHandle struct {
+	*n.Handle
+	// sockets are nil for the current network namespace
+	sockets map[int]*nl.SocketHandle
+}
+
+// Netlink returns handle of the current network namespace
+func Netlink() Handle {
+	return &NetlinkHandle{Handle: &n.Handle{}}
+}
+
+// NetlinkAt returns handle of network namespace, it must be released by Delete
+func NetlinkAt(namespace ns.NsHandle) (*NetlinkHandle, error) {
+	h, err := n.NewHandleAt(namespace, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, err
+	}
+	s, err := nl.GetNetlinkSocketAt(namespace, ns.None(), syscall.NETLINK_ROUTE)
+	if err != nil {
+		h.Delete()
+		return nil, err
+	}
+	return &NetlinkHandle{
+		Handle:  h,
+		sockets: map[int]*nl.SocketHandle{syscall.NETLINK_ROUTE: {Socket: s}},
+	}, nil
+}
+
+// Delete closes sockets of handle
+func (h *NetlinkHandle) Delete() {
+	for _, s := range h.sockets {
+		s.Close()
+	}
+	h.sockets = nil
+	h.Handle.Delete()
+}
+
+// parseLinkNames decodes names from attributes of a RTM_NEWLINK message
+func parseLinkNames(attrs []syscall.NetlinkRouteAttr) LinkNames {
+	result := LinkNames{AltNames: []string{}}
+	for _, attr := range attrs {
+		switch attr.Attr.Type & nlaTypeMask {
+		case iflaPropList:
+			props, err := nl.ParseRouteAttr(attr.Value)
+			if err != nil {
+				continue
+			}
+			for _, prop := range props {
+				if prop.Attr.Type&nlaTypeMask == iflaAltIfname {
+					result.AltNames = append(result.AltNames, nl.BytesToString(prop.Value))
+				}
+			}
+		case iflaPermAddress:
+			result.PermMAC = net.HardwareAddr(attr.Value).String()
+		}
+	}
+	return result
+}
+
+// LinkList dumps links as netlink Handle does and parses names from the same
+// messages
+func (h *NetlinkHandle) LinkList() ([]n.Link, map[int]LinkNames, error) {
+	req := nl.NewNetlinkRequest(syscall.RTM_GETLINK, syscall.NLM_F_DUMP)
+	// without sockets the request is sent from the current network namespace
+	req.Sockets = h.sockets
+	req.AddData(nl.NewIfInfomsg(syscall.AF_UNSPEC))
+	req.AddData(nl.NewRtAttr(iflaExtMask, nl.Uint32Attr(nl.RTEXT_FILTER_VF)))
+	msgs, err := req.Execute(syscall.NETLINK_ROUTE, syscall.RTM_NEWLINK)
+	if err != nil {
+		return nil, nil, err
+	}
+	links := make([]n.Link, 0, len(msgs))
+	names := make(map[int]LinkNames, len(msgs))
+	for _, m := range msgs {
+		link, err := n.LinkDeserialize(nil, m)
+		if err != nil {
+			return nil, nil, err
+		}
+		msg := nl.DeserializeIfInfomsg(m)
+		attrs, err := nl.ParseRouteAttr(m[msg.Len():])
+		if err != nil {
+			return nil, nil, err
+		}
+		links = append(links, link)
+		names[link.Attrs().Index] = parseLinkNames(attrs)
+	}
+	return links, names, nil
+}
+
+// Snapshot is a list of links taken by one query, link lookups are consistent
+// even when links change during collection
+type Snapshot struct {
+	Links   []n.Link
+	byIndex map[int]n.Link
+	names   map[int]LinkNames
+}
+
+// TakeSnapshot lists links via handle
+func TakeSnapshot(h Handle) (*Snapshot, error) {
+	links, names, err := h.LinkList()
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{
+		Links:   links,
+		byIndex: make(map[int]n.Link, len(links)),
+		names:   names,
+	}
+	for _, link := range links {
+		s.byIndex[link.Attrs().Index] = link
+	}
+	return s, nil
+}
+
+// ByIndex returns link with index
+func (s *Snapshot) ByIndex(index int) (n.Link, bool) {
+	link, ok := s.byIndex[index]
+	return link, ok
+}
+
+// Name returns name of link with index or empty string when there is no such
+// link or index is zero
+func (s *Snapshot) Name(index int) string {
+	if link, ok := s.byIndex[index]; ok {
+		return link.Attrs().Name
+	}
+	return ""
+}
+
+// Names returns alternative names and permanent address of link with index
+func (s *Snapshot) Names(index int) (LinkNames, bool) {
+	names, ok := s.names[index]
+	return names, ok
+}
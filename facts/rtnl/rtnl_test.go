@@ -0,0 +1,195 @@
+package rtnl
+
+import (
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	n "github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+func loadFake(t *testing.T) *Fake {
+	fake, err := LoadFake(filepath.Join("testdata", "netlink.json"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return fake
+}
+
+type nameTPair struct {
+	index    int
+	expected string
+}
+
+func TestSnapshot(t *testing.T) {
+	snap, err := TakeSnapshot(loadFake(t))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(snap.Links) != 6 {
+		t.Fatalf("%v != %v", len(snap.Links), 6)
+	}
+	tests := []nameTPair{
+		{0, ""},
+		{1, "lo"},
+		{4, "bond0"},
+		{5, "bond0.10"},
+		{42, ""},
+	}
+	for _, pair := range tests {
+		result := snap.Name(pair.index)
+		if result != pair.expected {
+			t.Fatalf("%v != %v", result, pair.expected)
+		}
+	}
+	if _, ok := snap.ByIndex(42); ok {
+		t.Fatalf("link 42 found")
+	}
+}
+
+type typeTPair struct {
+	index    int
+	expected string
+}
+
+func TestLoadFakeLinks(t *testing.T) {
+	snap, err := TakeSnapshot(loadFake(t))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	tests := []typeTPair{
+		{1, "device"},
+		{4, "bond"},
+		{5, "vlan"},
+		{6, "wireguard"},
+	}
+	for _, pair := range tests {
+		link, _ := snap.ByIndex(pair.index)
+		if link.Type() != pair.expected {
+			t.Fatalf("%v != %v", link.Type(), pair.expected)
+		}
+	}
+	bond, _ := snap.ByIndex(4)
+	if bond.(*n.Bond).Mode != n.BOND_MODE_ACTIVE_BACKUP {
+		t.Fatalf("%v != %v", bond.(*n.Bond).Mode, n.BOND_MODE_ACTIVE_BACKUP)
+	}
+	vlan, _ := snap.ByIndex(5)
+	if vlan.(*n.Vlan).VlanId != 10 || vlan.Attrs().ParentIndex != 4 {
+		t.Fatalf("unexpected vlan %v", vlan)
+	}
+	eth1, _ := snap.ByIndex(3)
+	if eth1.Attrs().OperState != n.OperDown || eth1.Attrs().HardwareAddr.String() != "52:54:00:aa:bb:cd" {
+		t.Fatalf("unexpected link %v", eth1.Attrs())
+	}
+}
+
+type routeGetTPair struct {
+	destination string
+	index       int
+	gateway     string
+}
+
+func TestRouteGet(t *testing.T) {
+	fake := loadFake(t)
+	tests := []routeGetTPair{
+		{"192.0.2.99", 5, "<nil>"},
+		{"10.8.0.7", 6, "<nil>"},
+		{"10.1.2.3", 6, "10.8.0.254"},
+		// the default route with the lowest metric wins
+		{"1.0.0.0", 5, "192.0.2.1"},
+		{"100::", 5, "2001:db8::1"},
+	}
+	for _, pair := range tests {
+		routes, err := fake.RouteGet(net.ParseIP(pair.destination))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if routes[0].LinkIndex != pair.index || routes[0].Gw.String() != pair.gateway {
+			t.Fatalf("%v != %v via %v", routes[0], pair.index, pair.gateway)
+		}
+	}
+	if _, err := (&Fake{}).RouteGet(net.ParseIP("1.0.0.0")); err == nil {
+		t.Fatalf("route found without routes")
+	}
+}
+
+type listTPair struct {
+	index    int
+	family   int
+	expected int
+}
+
+func TestAddrRouteList(t *testing.T) {
+	fake := loadFake(t)
+	snap, err := TakeSnapshot(fake)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	addrs := []listTPair{
+		{5, n.FAMILY_ALL, 2},
+		{5, n.FAMILY_V4, 1},
+		{5, n.FAMILY_V6, 1},
+		{2, n.FAMILY_ALL, 0},
+	}
+	for _, pair := range addrs {
+		link, _ := snap.ByIndex(pair.index)
+		result, _ := fake.AddrList(link, pair.family)
+		if len(result) != pair.expected {
+			t.Fatalf("%v != %v", len(result), pair.expected)
+		}
+	}
+	routes := []listTPair{
+		{5, n.FAMILY_V4, 2},
+		{5, n.FAMILY_V6, 1},
+		{6, n.FAMILY_ALL, 3},
+	}
+	for _, pair := range routes {
+		link, _ := snap.ByIndex(pair.index)
+		result, _ := fake.RouteList(link, pair.family)
+		if len(result) != pair.expected {
+			t.Fatalf("%v != %v", len(result), pair.expected)
+		}
+	}
+	all, _ := fake.AddrList(nil, n.FAMILY_V4)
+	if len(all) != 3 {
+		t.Fatalf("%v != %v", len(all), 3)
+	}
+	vlans, _ := fake.BridgeVlanList()
+	if len(vlans[4]) != 1 || vlans[4][0].Vid != 10 {
+		t.Fatalf("unexpected vlans %v", vlans)
+	}
+}
+
+func TestSnapshotNames(t *testing.T) {
+	snap, err := TakeSnapshot(loadFake(t))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	names, ok := snap.Names(2)
+	expected := LinkNames{AltNames: []string{"enp0s3", "uplink"}, PermMAC: "52:54:00:aa:bb:cc"}
+	if !ok || !reflect.DeepEqual(names, expected) {
+		t.Fatalf("%v != %v", names, expected)
+	}
+	if _, ok := snap.Names(3); ok {
+		t.Fatalf("link 3 has names")
+	}
+}
+
+func TestParseLinkNames(t *testing.T) {
+	props := nl.NewRtAttr(iflaPropList|nl.NLA_F_NESTED, nil)
+	props.AddRtAttr(iflaAltIfname, nl.ZeroTerminated("enp0s3f0"))
+	props.AddRtAttr(iflaAltIfname, nl.ZeroTerminated("uplink"))
+	perm := nl.NewRtAttr(iflaPermAddress, []byte{0x52, 0x54, 0, 0xaa, 0xbb, 0xcc})
+	attrs, err := nl.ParseRouteAttr(append(props.Serialize(), perm.Serialize()...))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	result := parseLinkNames(attrs)
+	expected := LinkNames{AltNames: []string{"enp0s3f0", "uplink"}, PermMAC: "52:54:00:aa:bb:cc"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+}
@@ -0,0 +1,495 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// D-Bus message types and header fields, see D-Bus specification
+const (
+	dbusMethodCall   = 1
+	dbusMethodReturn = 2
+	dbusError        = 3
+
+	dbusFieldPath        = 1
+	dbusFieldInterface   = 2
+	dbusFieldMember      = 3
+	dbusFieldErrorName   = 4
+	dbusFieldReplySerial = 5
+	dbusFieldDestination = 6
+	dbusFieldSignature   = 8
+
+	// messages longer than this are rejected
+	dbusMaxMessage = 128 * 1024 * 1024
+)
+
+// dbusConn is a minimal D-Bus client able to call methods with string
+// arguments and decode replies, it only speaks little-endian
+type dbusConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	serial uint32
+}
+
+// encoder marshals D-Bus values, alignment is relative to message start
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) align(n int) {
+	for e.buf.Len()%n != 0 {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *encoder) byte(v byte) {
+	e.buf.WriteByte(v)
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.align(4)
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	e.buf.Write(b)
+}
+
+func (e *encoder) string(v string) {
+	e.uint32(uint32(len(v)))
+	e.buf.WriteString(v)
+	e.buf.WriteByte(0)
+}
+
+func (e *encoder) signature(v string) {
+	e.buf.WriteByte(byte(len(v)))
+	e.buf.WriteString(v)
+	e.buf.WriteByte(0)
+}
+
+// field writes header field (code and variant) as struct
+func (e *encoder) field(code byte, sig string, value interface{}) {
+	e.align(8)
+	e.byte(code)
+	e.signature(sig)
+	switch v := value.(type) {
+	case string:
+		if sig == "g" {
+			e.signature(v)
+		} else {
+			e.string(v)
+		}
+	case uint32:
+		e.uint32(v)
+	}
+}
+
+// dbusMessage represents a message with body values decoded according to
+// its signature
+type dbusMessage struct {
+	kind        byte
+	serial      uint32
+	replySerial uint32
+	member      string
+	errorName   string
+	signature   string
+	body        []interface{}
+}
+
+// encodeMessage marshals message with already encoded body, the body starts at
+// 8-aligned offset so it can be encoded separately
+func encodeMessage(kind byte, serial uint32, fields map[byte]interface{}, body []byte) []byte {
+	e := &encoder{}
+	e.byte('l')
+	e.byte(kind)
+	e.byte(0)
+	e.byte(1)
+	e.uint32(uint32(len(body)))
+	e.uint32(serial)
+	fieldsEnc := &encoder{}
+	// header fields array starts at offset 16 which is 8-aligned
+	codes := []byte{dbusFieldPath, dbusFieldInterface, dbusFieldMember, dbusFieldErrorName,
+		dbusFieldReplySerial, dbusFieldDestination, dbusFieldSignature}
+	for _, code := range codes {
+		value, ok := fields[code]
+		if !ok {
+			continue
+		}
+		switch code {
+		case dbusFieldPath:
+			fieldsEnc.field(code, "o", value)
+		case dbusFieldReplySerial:
+			fieldsEnc.field(code, "u", value)
+		case dbusFieldSignature:
+			fieldsEnc.field(code, "g", value)
+		default:
+			fieldsEnc.field(code, "s", value)
+		}
+	}
+	e.uint32(uint32(fieldsEnc.buf.Len()))
+	e.buf.Write(fieldsEnc.buf.Bytes())
+	e.align(8)
+	e.buf.Write(body)
+	return e.buf.Bytes()
+}
+
+// decoder unmarshals D-Bus values, offsets are relative to message start
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *decoder) align(n int) error {
+	for d.pos%n != 0 {
+		d.pos++
+	}
+	if d.pos > len(d.data) {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if d.pos+n > len(d.data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// signatureEnd returns length of the first complete type in the signature
+func signatureEnd(sig string) (int, error) {
+	if sig == "" {
+		return 0, fmt.Errorf("Empty signature.")
+	}
+	switch sig[0] {
+	case 'a':
+		n, err := signatureEnd(sig[1:])
+		return n + 1, err
+	case '(', '{':
+		closing := byte(')')
+		if sig[0] == '{' {
+			closing = '}'
+		}
+		i := 1
+		for i < len(sig) && sig[i] != closing {
+			n, err := signatureEnd(sig[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+		if i >= len(sig) {
+			return 0, fmt.Errorf("Unterminated struct in signature %s.", sig)
+		}
+		return i + 1, nil
+	}
+	return 1, nil
+}
+
+func alignment(sig byte) int {
+	switch sig {
+	case 'y', 'g', 'v':
+		return 1
+	case 'n', 'q':
+		return 2
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	}
+	return 4
+}
+
+// value decodes a single complete type
+func (d *decoder) value(sig string) (interface{}, error) {
+	if sig == "" {
+		return nil, fmt.Errorf("Empty signature.")
+	}
+	if err := d.align(alignment(sig[0])); err != nil {
+		return nil, err
+	}
+	switch sig[0] {
+	case 'y':
+		b, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0], nil
+	case 'b', 'u', 'i', 'h':
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		v := binary.LittleEndian.Uint32(b)
+		switch sig[0] {
+		case 'b':
+			return v != 0, nil
+		case 'i':
+			return int32(v), nil
+		}
+		return v, nil
+	case 'n', 'q':
+		b, err := d.next(2)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.Uint16(b), nil
+	case 'x', 't', 'd':
+		b, err := d.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.Uint64(b), nil
+	case 's', 'o':
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.next(int(binary.LittleEndian.Uint32(b)) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return string(s[:len(s)-1]), nil
+	case 'g':
+		b, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.next(int(b[0]) + 1)
+		if err != nil {
+			return nil, err
+		}
+		return string(s[:len(s)-1]), nil
+	case 'v':
+		inner, err := d.value("g")
+		if err != nil {
+			return nil, err
+		}
+		// the signature comes from the wire, it must be a single complete type
+		if n, err := signatureEnd(inner.(string)); err != nil {
+			return nil, err
+		} else if n != len(inner.(string)) {
+			return nil, fmt.Errorf("Invalid variant signature %s.", inner)
+		}
+		return d.value(inner.(string))
+	case 'a':
+		b, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		length := int(binary.LittleEndian.Uint32(b))
+		elemSig := sig[1:]
+		if elemSig == "" {
+			return nil, fmt.Errorf("Missing array element type.")
+		}
+		if err := d.align(alignment(elemSig[0])); err != nil {
+			return nil, err
+		}
+		end := d.pos + length
+		if end > len(d.data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		result := []interface{}{}
+		for d.pos < end {
+			pos := d.pos
+			v, err := d.value(elemSig)
+			if err != nil {
+				return nil, err
+			}
+			if d.pos == pos {
+				return nil, fmt.Errorf("Array element %s has no data.", elemSig)
+			}
+			result = append(result, v)
+		}
+		return result, nil
+	case '(', '{':
+		closing := byte(')')
+		if sig[0] == '{' {
+			closing = '}'
+		}
+		if len(sig) < 3 || sig[len(sig)-1] != closing {
+			return nil, fmt.Errorf("Invalid struct signature %s.", sig)
+		}
+		result := []interface{}{}
+		inner := sig[1 : len(sig)-1]
+		for inner != "" {
+			n, err := signatureEnd(inner)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.value(inner[:n])
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, v)
+			inner = inner[n:]
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("Unsupported type %c.", sig[0])
+}
+
+// values decodes all complete types in the signature
+func (d *decoder) values(sig string) ([]interface{}, error) {
+	result := []interface{}{}
+	for sig != "" {
+		n, err := signatureEnd(sig)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.value(sig[:n])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+		sig = sig[n:]
+	}
+	return result, nil
+}
+
+// readMessage reads and decodes a single message
+func readMessage(r io.Reader) (*dbusMessage, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+	if fixed[0] != 'l' {
+		return nil, fmt.Errorf("Big-endian D-Bus messages are not supported.")
+	}
+	bodyLength := int(binary.LittleEndian.Uint32(fixed[4:8]))
+	fieldsLength := int(binary.LittleEndian.Uint32(fixed[12:16]))
+	headerLength := 16 + fieldsLength
+	if headerLength%8 != 0 {
+		headerLength += 8 - headerLength%8
+	}
+	if bodyLength > dbusMaxMessage || fieldsLength > dbusMaxMessage {
+		return nil, fmt.Errorf("D-Bus message too long.")
+	}
+	data := make([]byte, headerLength+bodyLength)
+	copy(data, fixed)
+	if _, err := io.ReadFull(r, data[16:]); err != nil {
+		return nil, err
+	}
+
+	msg := &dbusMessage{
+		kind:   fixed[1],
+		serial: binary.LittleEndian.Uint32(fixed[8:12]),
+	}
+	d := &decoder{data: data[:16+fieldsLength], pos: 12}
+	fields, err := d.value("a(yv)")
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields.([]interface{}) {
+		field := f.([]interface{})
+		switch field[0].(byte) {
+		case dbusFieldReplySerial:
+			msg.replySerial, _ = field[1].(uint32)
+		case dbusFieldMember:
+			msg.member, _ = field[1].(string)
+		case dbusFieldErrorName:
+			msg.errorName, _ = field[1].(string)
+		case dbusFieldSignature:
+			msg.signature, _ = field[1].(string)
+		}
+	}
+	d = &decoder{data: data, pos: headerLength}
+	msg.body, err = d.values(msg.signature)
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// dialDBus connects to D-Bus socket and authenticates with EXTERNAL mechanism,
+// hello must be sent when connecting to a bus daemon (not peer-to-peer)
+func dialDBus(path string, hello bool, timeout time.Duration) (*dbusConn, error) {
+	conn, err := net.DialTimeout("unix", path, timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	c := &dbusConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := fmt.Fprintf(conn, "\x00AUTH EXTERNAL %s\r\n", uid); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		conn.Close()
+		return nil, fmt.Errorf("D-Bus authentication failed: %s", strings.TrimSpace(line))
+	}
+	if _, err := fmt.Fprint(conn, "BEGIN\r\n"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if hello {
+		_, err := c.call("org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello")
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// call invokes method with string arguments and returns decoded reply body
+func (c *dbusConn) call(destination, path, iface, member string, args ...string) ([]interface{}, error) {
+	c.serial++
+	fields := map[byte]interface{}{
+		dbusFieldPath:      path,
+		dbusFieldInterface: iface,
+		dbusFieldMember:    member,
+	}
+	if destination != "" {
+		fields[dbusFieldDestination] = destination
+	}
+	body := &encoder{}
+	for _, arg := range args {
+		body.string(arg)
+	}
+	if len(args) > 0 {
+		fields[dbusFieldSignature] = strings.Repeat("s", len(args))
+	}
+	if _, err := c.conn.Write(encodeMessage(dbusMethodCall, c.serial, fields, body.buf.Bytes())); err != nil {
+		return nil, err
+	}
+	for {
+		msg, err := readMessage(c.reader)
+		if err != nil {
+			return nil, err
+		}
+		if msg.replySerial != c.serial {
+			// signals (e.g. NameAcquired) are ignored
+			continue
+		}
+		if msg.kind == dbusError {
+			text := ""
+			if len(msg.body) > 0 {
+				text, _ = msg.body[0].(string)
+			}
+			return nil, fmt.Errorf("%s: %s", msg.errorName, text)
+		}
+		if msg.kind != dbusMethodReturn {
+			return nil, fmt.Errorf("Unexpected D-Bus message type %d.", msg.kind)
+		}
+		return msg.body, nil
+	}
+}
+
+func (c *dbusConn) Close() error {
+	return c.conn.Close()
+}
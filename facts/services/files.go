@@ -0,0 +1,166 @@
+package services
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// unitDir is a directory from unit search path, runtime directories are
+// cleared on reboot
+type unitDir struct {
+	path    string
+	runtime bool
+}
+
+// resolve returns target of a symlink with absolute targets relative to
+// root directory
+func resolve(link string, root string) (string, error) {
+	target, err := os.Readlink(link)
+	if err != nil {
+		return "", err
+	}
+	if filepath.IsAbs(target) {
+		if target == os.DevNull {
+			return target, nil
+		}
+		return filepath.Join(root, target), nil
+	}
+	return filepath.Join(filepath.Dir(link), target), nil
+}
+
+// hasInstall returns true when unit file has [Install] section with any
+// directive systemctl enable acts on
+func hasInstall(filename string) bool {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line
+			continue
+		}
+		if section != "[Install]" {
+			continue
+		}
+		for _, key := range []string{"WantedBy", "RequiredBy", "UpheldBy", "Alias", "Also"} {
+			if strings.HasPrefix(line, key+"=") && strings.TrimSpace(line[len(key)+1:]) != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// templateName returns template unit name for an instance ("getty@tty1.service"
+// gives "getty@.service") or empty string
+func templateName(name string) string {
+	at := strings.Index(name, "@")
+	dot := strings.LastIndex(name, ".")
+	if at < 0 || dot < at || at+1 == dot {
+		return ""
+	}
+	return name[:at+1] + name[dot:]
+}
+
+// wantedUnits returns units linked from .wants, .requires and .upholds
+// directories, the value is true for links in runtime directories
+func wantedUnits(dirs []unitDir) map[string]bool {
+	result := make(map[string]bool)
+	for _, dir := range dirs {
+		entries, err := ioutil.ReadDir(dir.path)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			ext := filepath.Ext(entry.Name())
+			if !entry.IsDir() || (ext != ".wants" && ext != ".requires" && ext != ".upholds") {
+				continue
+			}
+			links, err := ioutil.ReadDir(filepath.Join(dir.path, entry.Name()))
+			if err != nil {
+				continue
+			}
+			for _, link := range links {
+				names := []string{link.Name()}
+				if template := templateName(link.Name()); template != "" {
+					names = append(names, template)
+				}
+				for _, name := range names {
+					if runtime, ok := result[name]; !ok || runtime {
+						result[name] = dir.runtime
+					}
+				}
+			}
+		}
+	}
+	return result
+}
+
+// unitFileStates computes enablement state of unit files the same way
+// systemctl list-unit-files does for the most common cases
+func unitFileStates(dirs []unitDir, root string) map[string]*unit {
+	wanted := wantedUnits(dirs)
+	result := make(map[string]*unit)
+	for _, dir := range dirs {
+		entries, err := ioutil.ReadDir(dir.path)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if _, ok := result[name]; ok || entry.IsDir() || !strings.Contains(name, ".") {
+				continue
+			}
+			filename := filepath.Join(dir.path, name)
+			state := ""
+			if entry.Mode()&os.ModeSymlink != 0 {
+				target, err := resolve(filename, root)
+				if err != nil {
+					continue
+				}
+				if target == os.DevNull {
+					state = "masked"
+				} else if filepath.Base(target) != name {
+					state = "alias"
+				}
+				filename = target
+			}
+			if state == "" {
+				if runtime, ok := wanted[name]; ok {
+					state = "enabled"
+					if runtime {
+						state = "enabled-runtime"
+					}
+				} else if hasInstall(filename) {
+					state = "disabled"
+				} else {
+					state = "static"
+				}
+			}
+			if state == "masked" && dir.runtime {
+				state = "masked-runtime"
+			}
+			result[name] = &unit{enabled: state}
+		}
+	}
+	return result
+}
+
+// defaultTarget returns the target default.target links to
+func defaultTarget(dirs []unitDir, root string) string {
+	for _, dir := range dirs {
+		target, err := resolve(filepath.Join(dir.path, "default.target"), root)
+		if err == nil {
+			return filepath.Base(target)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,221 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	c "github.com/lzap/ufacter/facts/common"
+	"github.com/lzap/ufacter/lib/ufacter"
+)
+
+// Units limits reported units, names without suffix are considered services,
+// all units are reported when empty
+var Units []string
+
+// Timeout for communication with systemd
+var Timeout = 2 * time.Second
+
+const (
+	systemdDestination = "org.freedesktop.systemd1"
+	systemdPath        = "/org/freedesktop/systemd1"
+	systemdManager     = "org.freedesktop.systemd1.Manager"
+)
+
+// unit represents state of a systemd unit, runtime state (load, active and
+// sub) is only available over D-Bus
+type unit struct {
+	load    string
+	active  string
+	sub     string
+	enabled string
+}
+
+// systemdState is everything reported by the module
+type systemdState struct {
+	units         map[string]*unit
+	defaultTarget string
+}
+
+func (s *systemdState) get(name string) *unit {
+	u, ok := s.units[name]
+	if !ok {
+		u = &unit{}
+		s.units[name] = u
+	}
+	return u
+}
+
+// normalizeUnits appends ".service" to names without unit type suffix
+func normalizeUnits(names []string) []string {
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !strings.Contains(name, ".") {
+			name += ".service"
+		}
+		result = append(result, name)
+	}
+	return result
+}
+
+// dbusSocket is a D-Bus socket, hello is needed for bus daemon connections
+type dbusSocket struct {
+	path  string
+	hello bool
+}
+
+// sockets returns D-Bus sockets to try, the systemd private socket is
+// peer-to-peer and does not need dbus-daemon running (root only)
+func sockets() []dbusSocket {
+	return []dbusSocket{
+		{c.HostPath("run", "systemd", "private"), false},
+		{c.HostPath("run", "dbus", "system_bus_socket"), true},
+	}
+}
+
+// queryDBus reads units, unit files and the default target from systemd
+func queryDBus(conn *dbusConn) (*systemdState, error) {
+	state := &systemdState{units: make(map[string]*unit)}
+
+	// a(ssssssouso): name, description, load, active, sub, following, path,
+	// job id, job type, job path
+	reply, err := conn.call(systemdDestination, systemdPath, systemdManager, "ListUnits")
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) == 1 {
+		list, _ := reply[0].([]interface{})
+		for _, item := range list {
+			fields, ok := item.([]interface{})
+			if !ok || len(fields) < 5 {
+				continue
+			}
+			name, _ := fields[0].(string)
+			u := state.get(name)
+			u.load, _ = fields[2].(string)
+			u.active, _ = fields[3].(string)
+			u.sub, _ = fields[4].(string)
+		}
+	}
+
+	// a(ss): unit file path, enablement state
+	reply, err = conn.call(systemdDestination, systemdPath, systemdManager, "ListUnitFiles")
+	if err != nil {
+		return nil, err
+	}
+	if len(reply) == 1 {
+		list, _ := reply[0].([]interface{})
+		for _, item := range list {
+			fields, ok := item.([]interface{})
+			if !ok || len(fields) < 2 {
+				continue
+			}
+			path, _ := fields[0].(string)
+			state.get(filepath.Base(path)).enabled, _ = fields[1].(string)
+		}
+	}
+
+	reply, err = conn.call(systemdDestination, systemdPath, systemdManager, "GetDefaultTarget")
+	if err == nil && len(reply) == 1 {
+		state.defaultTarget, _ = reply[0].(string)
+	}
+	return state, nil
+}
+
+// readDBus tries all known sockets and returns state from the first one
+// which works
+func readDBus() (*systemdState, error) {
+	var lastErr error
+	for _, socket := range sockets() {
+		conn, err := dialDBus(socket.path, socket.hello, Timeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		state, err := queryDBus(conn)
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return state, nil
+	}
+	return nil, lastErr
+}
+
+// unitDirs returns system unit search path in order of priority
+func unitDirs() []unitDir {
+	return []unitDir{
+		{c.HostPath("etc", "systemd", "system"), false},
+		{c.HostPath("run", "systemd", "system"), true},
+		{c.HostPath("usr", "local", "lib", "systemd", "system"), false},
+		{c.HostPath("usr", "lib", "systemd", "system"), false},
+		{c.HostPath("lib", "systemd", "system"), false},
+	}
+}
+
+// readFiles reads unit file states and the default target from unit
+// directories, used when systemd is not reachable over D-Bus
+func readFiles() *systemdState {
+	dirs := unitDirs()
+	return &systemdState{
+		units:         unitFileStates(dirs, c.GetHostRoot()),
+		defaultTarget: defaultTarget(dirs, c.GetHostRoot()),
+	}
+}
+
+// ReportFacts reports systemd units with their state and the default target
+func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
+	start := time.Now()
+	defer ufacter.SendLastFact(facts)
+
+	var state *systemdState
+	if c.Offline() {
+		// systemd of the tree is not running, unit files are still there
+		state = readFiles()
+	} else {
+		// systemd creates this directory when it is running as init
+		_, err := os.Stat(c.HostPath("run", "systemd", "system"))
+		booted := err == nil
+
+		if state, err = readDBus(); err != nil {
+			if booted {
+				c.LogError(facts, err, "services", "D-Bus")
+			}
+			state = readFiles()
+		}
+	}
+	if len(state.units) == 0 && state.defaultTarget == "" {
+		// not a systemd system
+		return
+	}
+
+	names := normalizeUnits(Units)
+	if len(names) == 0 {
+		for name := range state.units {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		u, ok := state.units[name]
+		if !ok {
+			continue
+		}
+		// whether a unit is loaded and running is part of the system state,
+		// the low-level sub-state passes through transient values
+		facts <- ufacter.NewStableFactEx(u.load, "services", "units", name, "load")
+		facts <- ufacter.NewStableFactEx(u.active, "services", "units", name, "active")
+		facts <- ufacter.NewVolatileFactEx(u.sub, "services", "units", name, "sub")
+		facts <- ufacter.NewStableFactEx(u.enabled, "services", "units", name, "enabled")
+	}
+	facts <- ufacter.NewStableFactEx(state.defaultTarget, "services", "default_target")
+
+	ufacter.SendVolatileFactEx(facts, time.Since(start), "ufacter", "stats", "services")
+}
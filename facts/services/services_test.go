@@ -0,0 +1,334 @@
+package services
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	c "github.com/lzap/ufacter/facts/common"
+	"github.com/lzap/ufacter/lib/ufacter"
+)
+
+type normalizeTPair struct {
+	input    []string
+	expected []string
+}
+
+func TestNormalizeUnits(t *testing.T) {
+	tests := []normalizeTPair{
+		{[]string{"sshd", "chronyd.service", "multi-user.target"}, []string{"sshd.service", "chronyd.service", "multi-user.target"}},
+		{[]string{" sshd ", ""}, []string{"sshd.service"}},
+		{nil, []string{}},
+	}
+	for _, pair := range tests {
+		result := normalizeUnits(pair.input)
+		if !reflect.DeepEqual(result, pair.expected) {
+			t.Fatalf("%v != %v", result, pair.expected)
+		}
+	}
+}
+
+type templateTPair struct {
+	input    string
+	expected string
+}
+
+func TestTemplateName(t *testing.T) {
+	tests := []templateTPair{
+		{"getty@tty1.service", "getty@.service"},
+		{"getty@.service", ""},
+		{"sshd.service", ""},
+		{"weird@", ""},
+	}
+	for _, pair := range tests {
+		if result := templateName(pair.input); result != pair.expected {
+			t.Fatalf("%v != %v", result, pair.expected)
+		}
+	}
+}
+
+// writeUnitTree creates etc, run and usr unit directories with a mix of
+// enabled, disabled, static, masked and alias units
+func writeUnitTree(t *testing.T, root string) []unitDir {
+	etc := filepath.Join(root, "etc", "systemd", "system")
+	run := filepath.Join(root, "run", "systemd", "system")
+	usr := filepath.Join(root, "usr", "lib", "systemd", "system")
+	for _, dir := range []string{
+		filepath.Join(etc, "multi-user.target.wants"),
+		filepath.Join(etc, "getty.target.wants"),
+		filepath.Join(run, "multi-user.target.wants"),
+		usr,
+	} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	install := "[Unit]\nDescription=Test\n\n[Install]\nWantedBy=multi-user.target\n"
+	files := map[string]string{
+		"sshd.service":      install,
+		"chronyd.service":   install,
+		"cups.service":      install,
+		"debug.service":     install,
+		"getty@.service":    "[Install]\nWantedBy=getty.target\n",
+		"dbus.socket":       "[Unit]\nDescription=Static\n",
+		"multi-user.target": "[Unit]\n[Install]\nAlias=\n",
+		"rescue.target":     "[Unit]\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(usr, name), []byte(content), 0644); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	links := map[string]string{
+		filepath.Join(etc, "multi-user.target.wants", "sshd.service"):  "/usr/lib/systemd/system/sshd.service",
+		filepath.Join(etc, "getty.target.wants", "getty@tty1.service"): "/usr/lib/systemd/system/getty@.service",
+		filepath.Join(run, "multi-user.target.wants", "debug.service"): "/usr/lib/systemd/system/debug.service",
+		filepath.Join(etc, "cups.service"):                             "/dev/null",
+		filepath.Join(etc, "dbus-org.example.service"):                 "/usr/lib/systemd/system/chronyd.service",
+		filepath.Join(etc, "default.target"):                           "/usr/lib/systemd/system/multi-user.target",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	return []unitDir{{etc, false}, {run, true}, {usr, false}}
+}
+
+func TestUnitFileStates(t *testing.T) {
+	root, err := ioutil.TempDir("", "ufacter-services")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(root)
+	dirs := writeUnitTree(t, root)
+
+	units := unitFileStates(dirs, root)
+	expected := map[string]string{
+		"sshd.service":             "enabled",
+		"chronyd.service":          "disabled",
+		"cups.service":             "masked",
+		"debug.service":            "enabled-runtime",
+		"getty@.service":           "enabled",
+		"dbus.socket":              "static",
+		"dbus-org.example.service": "alias",
+		"default.target":           "alias",
+		"multi-user.target":        "static",
+		"rescue.target":            "static",
+	}
+	result := make(map[string]string)
+	for name, u := range units {
+		result[name] = u.enabled
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+	if target := defaultTarget(dirs, root); target != "multi-user.target" {
+		t.Fatalf("%v != multi-user.target", target)
+	}
+}
+
+// encodeUnits encodes ListUnits reply body of a(ssssssouso) type
+func encodeUnits(units [][]string) []byte {
+	e := &encoder{}
+	e.uint32(0)
+	e.align(8)
+	start := e.buf.Len()
+	for _, u := range units {
+		e.align(8)
+		for _, s := range u[:6] {
+			e.string(s)
+		}
+		e.string("/org/freedesktop/systemd1/unit/x")
+		e.uint32(0)
+		e.string("")
+		e.string("/")
+	}
+	body := e.buf.Bytes()
+	binary.LittleEndian.PutUint32(body[0:], uint32(len(body)-start))
+	return body
+}
+
+// encodeUnitFiles encodes ListUnitFiles reply body of a(ss) type
+func encodeUnitFiles(files [][2]string) []byte {
+	e := &encoder{}
+	e.uint32(0)
+	e.align(8)
+	start := e.buf.Len()
+	for _, f := range files {
+		e.align(8)
+		e.string(f[0])
+		e.string(f[1])
+	}
+	body := e.buf.Bytes()
+	binary.LittleEndian.PutUint32(body[0:], uint32(len(body)-start))
+	return body
+}
+
+// serveSystemd answers a single connection as systemd private socket would
+func serveSystemd(t *testing.T, listener net.Listener) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "\x00AUTH EXTERNAL ") {
+		t.Errorf("unexpected auth %q", line)
+		return
+	}
+	conn.Write([]byte("OK 0123456789abcdef0123456789abcdef\r\n"))
+	if line, _ = reader.ReadString('\n'); line != "BEGIN\r\n" {
+		t.Errorf("unexpected begin %q", line)
+		return
+	}
+	serial := uint32(100)
+	for {
+		msg, err := readMessage(reader)
+		if err != nil {
+			return
+		}
+		serial++
+		fields := map[byte]interface{}{dbusFieldReplySerial: msg.serial}
+		var body []byte
+		kind := byte(dbusMethodReturn)
+		switch msg.member {
+		case "ListUnits":
+			fields[dbusFieldSignature] = "a(ssssssouso)"
+			body = encodeUnits([][]string{
+				{"sshd.service", "OpenSSH", "loaded", "active", "running", ""},
+				{"dev-sda.device", "Disk", "loaded", "active", "plugged", ""},
+			})
+		case "ListUnitFiles":
+			fields[dbusFieldSignature] = "a(ss)"
+			body = encodeUnitFiles([][2]string{
+				{"/usr/lib/systemd/system/sshd.service", "enabled"},
+				{"/usr/lib/systemd/system/cups.service", "masked"},
+			})
+		case "GetDefaultTarget":
+			fields[dbusFieldSignature] = "s"
+			e := &encoder{}
+			e.string("graphical.target")
+			body = e.buf.Bytes()
+		default:
+			kind = dbusError
+			fields[dbusFieldErrorName] = "org.freedesktop.DBus.Error.UnknownMethod"
+			fields[dbusFieldSignature] = "s"
+			e := &encoder{}
+			e.string("Unknown method")
+			body = e.buf.Bytes()
+		}
+		// signal which must be skipped by the client
+		conn.Write(encodeMessage(4, serial, map[byte]interface{}{dbusFieldMember: "NameAcquired"}, nil))
+		conn.Write(encodeMessage(kind, serial, fields, body))
+	}
+}
+
+func TestQueryDBus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ufacter-dbus")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	listener, err := net.Listen("unix", filepath.Join(dir, "private"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer listener.Close()
+	go serveSystemd(t, listener)
+
+	conn, err := dialDBus(filepath.Join(dir, "private"), false, 5*time.Second)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer conn.Close()
+	state, err := queryDBus(conn)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := map[string]unit{
+		"sshd.service":   {"loaded", "active", "running", "enabled"},
+		"dev-sda.device": {"loaded", "active", "plugged", ""},
+		"cups.service":   {"", "", "", "masked"},
+	}
+	result := make(map[string]unit)
+	for name, u := range state.units {
+		result[name] = *u
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+	if state.defaultTarget != "graphical.target" {
+		t.Fatalf("%v != graphical.target", state.defaultTarget)
+	}
+	if _, err := conn.call(systemdDestination, systemdPath, systemdManager, "Missing"); err == nil {
+		t.Fatalf("expected error for unknown method")
+	}
+}
+
+func TestReportFactsOffline(t *testing.T) {
+	root, err := ioutil.TempDir("", "ufacter-services")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(root)
+	writeUnitTree(t, root)
+	if err := c.SetHostRoot(root); err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer c.ResetHostRoot()
+
+	result := ufacter.FactMap(ufacter.Collect([]ufacter.Reporter{ReportFacts}, false, true), false)
+	if result["services.units.sshd.service.enabled"] != "enabled" {
+		t.Fatalf("%v != enabled", result["services.units.sshd.service.enabled"])
+	}
+	if result["services.default_target"] != "multi-user.target" {
+		t.Fatalf("%v != multi-user.target", result["services.default_target"])
+	}
+	if _, ok := result["ufacter.unavailable.services"]; ok {
+		t.Fatalf("services reported unavailable offline")
+	}
+}
+
+// variant encodes a variant with signature followed by data
+func variant(sig string, data ...byte) []byte {
+	e := &encoder{}
+	e.signature(sig)
+	e.buf.Write(data)
+	return e.buf.Bytes()
+}
+
+type malformedTPair struct {
+	sig  string
+	data []byte
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	tests := []malformedTPair{
+		{"v", variant("")},
+		{"v", variant("a", 4, 0, 0, 0, 1, 2, 3, 4)},
+		{"v", variant("(", 1, 2, 3, 4, 5, 6, 7, 8)},
+		{"v", variant("{", 1, 2, 3, 4, 5, 6, 7, 8)},
+		{"v", variant("(s", 1, 2, 3, 4, 5, 6, 7, 8)},
+		{"v", variant("ss", 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)},
+		{"v", variant("a()", 4, 0, 0, 0, 0, 0, 0, 0)},
+		{"a", []byte{4, 0, 0, 0, 1, 2, 3, 4}},
+		{"(", []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+		{"(s]", []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+		{"", nil},
+	}
+	for _, pair := range tests {
+		d := &decoder{data: pair.data}
+		if v, err := d.value(pair.sig); err == nil {
+			t.Fatalf("%s %v: expected error, got %v", pair.sig, pair.data, v)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package ssh
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	c "github.com/lzap/ufacter/facts/common"
+	"github.com/lzap/ufacter/lib/ufacter"
+)
+
+// keyTypes maps key type prefix to name and SSHFP algorithm number (RFC 4255,
+// RFC 6594 and RFC 7479)
+var keyTypes = []struct {
+	prefix    string
+	name      string
+	algorithm int
+}{
+	{"ssh-rsa", "rsa", 1},
+	{"ssh-dss", "dsa", 2},
+	{"ecdsa-sha2-", "ecdsa", 3},
+	{"ssh-ed25519", "ed25519", 4},
+}
+
+// hostKey represents a public host key with fingerprints
+type hostKey struct {
+	name    string
+	keyType string
+	key     string
+	sha1    string
+	sha256  string
+	openssh string
+}
+
+// parseKey parses public key in OpenSSH authorized_keys format
+func parseKey(content string) (*hostKey, error) {
+	fields := strings.Fields(content)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("Invalid public key format.")
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, err
+	}
+	// the blob starts with key type as SSH string which must match
+	length := -1
+	if len(blob) >= 4 {
+		length = int(binary.BigEndian.Uint32(blob))
+	}
+	if length < 0 || length > len(blob)-4 || string(blob[4:4+length]) != fields[0] {
+		return nil, fmt.Errorf("Key type %s does not match key data.", fields[0])
+	}
+	for _, t := range keyTypes {
+		if !strings.HasPrefix(fields[0], t.prefix) {
+			continue
+		}
+		sum1 := sha1.Sum(blob)
+		sum256 := sha256.Sum256(blob)
+		return &hostKey{
+			name:    t.name,
+			keyType: fields[0],
+			key:     fields[1],
+			sha1:    fmt.Sprintf("SSHFP %d 1 %x", t.algorithm, sum1),
+			sha256:  fmt.Sprintf("SSHFP %d 2 %x", t.algorithm, sum256),
+			openssh: "SHA256:" + base64.RawStdEncoding.EncodeToString(sum256[:]),
+		}, nil
+	}
+	return nil, fmt.Errorf("Unsupported key type %s.", fields[0])
+}
+
+// ReportFacts reads SSH host public keys and reports them with fingerprints
+// in the same format as facter
+func ReportFacts(facts chan<- ufacter.Fact, volatile bool, extended bool) {
+	start := time.Now()
+	defer ufacter.SendLastFact(facts)
+
+	files, err := filepath.Glob(c.HostPath("etc", "ssh", "ssh_host_*_key.pub"))
+	if err != nil {
+		c.LogError(facts, err, "ssh", "glob")
+	}
+	for _, filename := range files {
+		content, err := c.ReadFileString(filename)
+		if err != nil {
+			c.LogError(facts, err, "ssh", filepath.Base(filename))
+			continue
+		}
+		key, err := parseKey(content)
+		if err != nil {
+			c.LogError(facts, err, "ssh", filepath.Base(filename))
+			continue
+		}
+		facts <- ufacter.NewStableFact(key.key, "ssh", key.name, "key")
+		facts <- ufacter.NewStableFact(key.keyType, "ssh", key.name, "type")
+		facts <- ufacter.NewStableFact(key.sha1, "ssh", key.name, "fingerprints", "sha1")
+		facts <- ufacter.NewStableFact(key.sha256, "ssh", key.name, "fingerprints", "sha256")
+		facts <- ufacter.NewStableFactEx(key.openssh, "ssh", key.name, "fingerprints", "openssh")
+	}
+
+	ufacter.SendVolatileFactEx(facts, time.Since(start), "ufacter", "stats", "ssh")
+}
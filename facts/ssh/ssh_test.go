@@ -0,0 +1,64 @@
+package ssh
+
+import (
+	"path/filepath"
+	"testing"
+
+	c "github.com/lzap/ufacter/facts/common"
+)
+
+type keyTPair struct {
+	file    string
+	name    string
+	keyType string
+	sha1    string
+	sha256  string
+	openssh string
+}
+
+// expected values were generated by ssh-keygen -r and ssh-keygen -l
+func TestParseKey(t *testing.T) {
+	tests := []keyTPair{
+		{"ssh_host_rsa_key.pub", "rsa", "ssh-rsa",
+			"SSHFP 1 1 64cef8f85a50ace1229eb1a0f55ee9e2709e1e37",
+			"SSHFP 1 2 dcd46919d30235eb76bc05449a1f5aef308ab0af19692ba4b8c250bf9433d644",
+			"SHA256:3NRpGdMCNet2vAVEmh9a7zCKsK8ZaSukuMJQv5Qz1kQ"},
+		{"ssh_host_ecdsa_key.pub", "ecdsa", "ecdsa-sha2-nistp256",
+			"SSHFP 3 1 6d1a9fd9c9e29dd3cc42f562465bca58495aaf87",
+			"SSHFP 3 2 870b03e89613d635424be48292ecf802fb21be9dfc5f5eb4ec20ef0677aa9fff",
+			"SHA256:hwsD6JYT1jVCS+SCkuz4Avshvp38X1607CDvBneqn/8"},
+		{"ssh_host_ed25519_key.pub", "ed25519", "ssh-ed25519",
+			"SSHFP 4 1 bb1359c6824870aff23a70e67b07fa7b1e3b3f6b",
+			"SSHFP 4 2 00a19105e0e9594d5cf275083a2be3acdcf2a5a18628a4a5b094f207bda8365a",
+			"SHA256:AKGRBeDpWU1c8nUIOivjrNzypaGGKKSlsJTyB72oNlo"},
+	}
+	for _, pair := range tests {
+		content, err := c.ReadFileString(filepath.Join("testdata", "etc", "ssh", pair.file))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		key, err := parseKey(content)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if key.name != pair.name || key.keyType != pair.keyType {
+			t.Fatalf("%v %v != %v %v", key.name, key.keyType, pair.name, pair.keyType)
+		}
+		if key.sha1 != pair.sha1 || key.sha256 != pair.sha256 || key.openssh != pair.openssh {
+			t.Fatalf("%v %v %v != %v %v %v", key.sha1, key.sha256, key.openssh, pair.sha1, pair.sha256, pair.openssh)
+		}
+	}
+}
+
+func TestParseKeyInvalid(t *testing.T) {
+	for _, content := range []string{
+		"not a key",
+		"ssh-rsa",
+		"ssh-rsa AAAAC3NzaC1lZDI1NTE5AAAAIBAD",
+		"ssh-foo AAAAB3NzaC1yc2E=",
+	} {
+		if _, err := parseKey(content); err == nil {
+			t.Fatalf("expected error for %q", content)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package virtual
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+
+// cpuidHypervisor returns vendor signature from hypervisor CPUID leaf
+// 0x40000000 when the hypervisor present bit is set
+func cpuidHypervisor() string {
+	_, _, ecx, _ := cpuid(1, 0)
+	if ecx&(1<<31) == 0 {
+		return ""
+	}
+	_, ebx, ecx, edx := cpuid(0x40000000, 0)
+	signature := make([]byte, 12)
+	binary.LittleEndian.PutUint32(signature[0:], ebx)
+	binary.LittleEndian.PutUint32(signature[4:], ecx)
+	binary.LittleEndian.PutUint32(signature[8:], edx)
+	return strings.TrimRight(string(signature), "\x00")
+}
@@ -0,0 +1,9 @@
+//go:build !amd64
+// +build !amd64
+
+package virtual
+
+// cpuidHypervisor is only implemented on amd64
+func cpuidHypervisor() string {
+	return ""
+}
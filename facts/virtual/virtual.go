@@ -0,0 +1,254 @@
+package virtual
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	c "github.com/lzap/ufacter/facts/common"
+)
+
+// Physical is reported in the "virtual" fact on bare metal
+const Physical = "physical"
+
+// dmiVendor maps DMI string prefixes to hypervisors, the list follows
+// systemd-detect-virt
+type dmiVendor struct {
+	prefix     string
+	hypervisor string
+}
+
+var dmiVendors = []dmiVendor{
+	{"KVM", "kvm"},
+	{"OpenStack", "kvm"},
+	{"KubeVirt", "kvm"},
+	{"Amazon EC2", "kvm"},
+	{"Google Compute Engine", "kvm"},
+	{"QEMU", "qemu"},
+	{"VMware", "vmware"},
+	{"VMW", "vmware"},
+	{"innotek GmbH", "virtualbox"},
+	{"VirtualBox", "virtualbox"},
+	{"Xen", "xen"},
+	{"Bochs", "bochs"},
+	{"Parallels", "parallels"},
+	{"BHYVE", "bhyve"},
+	{"Hyper-V", "hyperv"},
+}
+
+// DMI files checked for vendor strings
+var dmiFiles = []string{"product_name", "sys_vendor", "board_vendor", "bios_vendor", "product_version"}
+
+// cpuidVendors maps CPUID leaf 0x40000000 signatures to hypervisors
+var cpuidVendors = map[string]string{
+	"KVMKVMKVM":    "kvm",
+	"TCGTCGTCGTCG": "qemu",
+	"VMwareVMware": "vmware",
+	"Microsoft Hv": "hyperv",
+	"XenVMMXenVMM": "xen",
+	"bhyve bhyve ": "bhyve",
+	"VBoxVBoxVBox": "virtualbox",
+	" lrpepyh vr":  "parallels",
+	"ACRNACRNACRN": "acrn",
+}
+
+// cgroupRuntimes maps substrings of /proc/1/cgroup to container runtimes
+type cgroupRuntime struct {
+	substring string
+	runtime   string
+}
+
+var cgroupRuntimes = []cgroupRuntime{
+	{"libpod", "podman"},
+	{"/docker/", "docker"},
+	{"/docker-", "docker"},
+	{"/lxc/", "lxc"},
+	{"lxc.payload", "lxc"},
+	{"/machine.slice/machine-", "systemd-nspawn"},
+}
+
+// Result of virtualization detection, empty strings mean nothing was detected
+type Result struct {
+	Hypervisor string
+	Container  string
+	// Xen control domain (dom0)
+	Privileged bool
+}
+
+// Nested returns true when a container runs inside a virtual machine
+func (r Result) Nested() bool {
+	return r.Hypervisor != "" && r.Container != ""
+}
+
+// IsVirtual returns false for bare metal hosts and Xen dom0 as facter does
+func (r Result) IsVirtual() bool {
+	virtual := r.Virtual()
+	return virtual != Physical && virtual != "xen0"
+}
+
+// Virtual returns virtualization name as reported by facter in the "virtual"
+// fact, container wins over hypervisor
+func (r Result) Virtual() string {
+	switch {
+	case r.Container == "systemd-nspawn":
+		return "systemd_nspawn"
+	case r.Container != "":
+		return r.Container
+	case r.Hypervisor == "xen" && r.Privileged:
+		return "xen0"
+	case r.Hypervisor == "xen":
+		return "xenu"
+	case r.Hypervisor != "":
+		return r.Hypervisor
+	}
+	return Physical
+}
+
+// Detector combines DMI strings, CPUID hypervisor leaves and container
+// runtime hints to detect virtualization, paths are configurable for testing
+type Detector struct {
+	Root string
+	Proc string
+	Sys  string
+	Run  string
+	// CPUID returns hypervisor vendor signature or empty string
+	CPUID func() string
+}
+
+// NewDetector returns detector for the running system, CPUID is not used
+// when collecting offline
+func NewDetector() *Detector {
+	d := &Detector{
+		Root:  c.GetHostRoot(),
+		Proc:  c.GetHostProc(),
+		Sys:   c.GetHostSys(),
+		Run:   c.GetHostRun(),
+		CPUID: cpuidHypervisor,
+	}
+	if c.Offline() {
+		d.CPUID = func() string { return "" }
+	}
+	return d
+}
+
+func exists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
+
+// Detect runs container and hypervisor detection
+func (d *Detector) Detect() Result {
+	result := Result{
+		Container:  d.detectContainer(),
+		Hypervisor: d.detectHypervisor(),
+	}
+	if result.Hypervisor == "xen" {
+		capabilities, err := ioutil.ReadFile(filepath.Join(d.Proc, "xen", "capabilities"))
+		result.Privileged = err == nil && bytes.Contains(capabilities, []byte("control_d"))
+	}
+	return result
+}
+
+// environContainer returns value of "container" variable from environment
+// of the init process (readable by root only)
+func (d *Detector) environContainer() string {
+	environ, err := ioutil.ReadFile(filepath.Join(d.Proc, "1", "environ"))
+	if err != nil {
+		return ""
+	}
+	for _, v := range bytes.Split(environ, []byte{0}) {
+		if bytes.HasPrefix(v, []byte("container=")) {
+			return string(bytes.TrimPrefix(v, []byte("container=")))
+		}
+	}
+	return ""
+}
+
+func normalizeContainer(name string) string {
+	switch name {
+	case "oci":
+		return "docker"
+	case "lxc-libvirt":
+		return "lxc"
+	}
+	return name
+}
+
+func (d *Detector) detectContainer() string {
+	if exists(filepath.Join(d.Proc, "vz")) && !exists(filepath.Join(d.Proc, "bc")) {
+		return "openvz"
+	}
+	// written by systemd-nspawn, podman and other runtimes following the container interface
+	name, err := c.ReadFileString(filepath.Join(d.Run, "systemd", "container"))
+	if err == nil && name != "" {
+		return normalizeContainer(name)
+	}
+	if name := d.environContainer(); name != "" {
+		return normalizeContainer(name)
+	}
+	if exists(filepath.Join(d.Run, ".containerenv")) {
+		return "podman"
+	}
+	if exists(filepath.Join(d.Root, ".dockerenv")) {
+		return "docker"
+	}
+	cgroup, err := ioutil.ReadFile(filepath.Join(d.Proc, "1", "cgroup"))
+	if err == nil {
+		for _, v := range cgroupRuntimes {
+			if bytes.Contains(cgroup, []byte(v.substring)) {
+				return v.runtime
+			}
+		}
+	}
+	return ""
+}
+
+func (d *Detector) detectDMI() string {
+	for _, file := range dmiFiles {
+		value, err := c.ReadFileString(filepath.Join(d.Sys, "class", "dmi", "id", file))
+		if err != nil || value == "" {
+			continue
+		}
+		for _, v := range dmiVendors {
+			if strings.HasPrefix(value, v.prefix) {
+				return v.hypervisor
+			}
+		}
+	}
+	vendor, _ := c.ReadFileString(filepath.Join(d.Sys, "class", "dmi", "id", "sys_vendor"))
+	product, _ := c.ReadFileString(filepath.Join(d.Sys, "class", "dmi", "id", "product_name"))
+	if vendor == "Microsoft Corporation" && product == "Virtual Machine" {
+		return "hyperv"
+	}
+	return ""
+}
+
+func (d *Detector) detectHypervisor() string {
+	dmi := d.detectDMI()
+	// DMI is more reliable for vendors which expose KVM signature via CPUID
+	if dmi == "xen" || dmi == "virtualbox" {
+		return dmi
+	}
+	if d.CPUID != nil {
+		if hv, ok := cpuidVendors[d.CPUID()]; ok {
+			return hv
+		}
+	}
+	if dmi != "" {
+		return dmi
+	}
+	hvType, err := c.ReadFileString(filepath.Join(d.Sys, "hypervisor", "type"))
+	if err == nil && hvType == "xen" {
+		return "xen"
+	}
+	if exists(filepath.Join(d.Proc, "xen")) {
+		return "xen"
+	}
+	cpuinfo, err := ioutil.ReadFile(filepath.Join(d.Proc, "cpuinfo"))
+	if err == nil && bytes.Contains(cpuinfo, []byte("User Mode Linux")) {
+		return "uml"
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package virtual
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+type detectTPair struct {
+	fixture    string
+	hypervisor string
+	container  string
+	virtual    string
+	isVirtual  bool
+	nested     bool
+}
+
+// fixtureDetector returns detector for a fixture tree in testdata, CPUID
+// signature is read from "cpuid" file in the fixture root
+func fixtureDetector(fixture string) *Detector {
+	root := filepath.Join("testdata", fixture)
+	return &Detector{
+		Root: root,
+		Proc: filepath.Join(root, "proc"),
+		Sys:  filepath.Join(root, "sys"),
+		Run:  filepath.Join(root, "run"),
+		CPUID: func() string {
+			signature, err := ioutil.ReadFile(filepath.Join(root, "cpuid"))
+			if err != nil {
+				return ""
+			}
+			return string(signature)
+		},
+	}
+}
+
+func TestDetect(t *testing.T) {
+	testPairs := []detectTPair{
+		{"physical", "", "", "physical", false, false},
+		{"kvm", "kvm", "", "kvm", true, false},
+		{"qemu", "qemu", "", "qemu", true, false},
+		{"vmware", "vmware", "", "vmware", true, false},
+		{"hyperv", "hyperv", "", "hyperv", true, false},
+		{"xenu", "xen", "", "xenu", true, false},
+		{"xen0", "xen", "", "xen0", false, false},
+		{"virtualbox", "virtualbox", "", "virtualbox", true, false},
+		{"docker", "", "docker", "docker", true, false},
+		{"docker-cgroup", "", "docker", "docker", true, false},
+		{"podman", "", "podman", "podman", true, false},
+		{"lxc", "", "lxc", "lxc", true, false},
+		{"lxc-cgroup", "", "lxc", "lxc", true, false},
+		{"nspawn", "", "systemd-nspawn", "systemd_nspawn", true, false},
+		{"openvz", "", "openvz", "openvz", true, false},
+		{"nested", "kvm", "docker", "docker", true, true},
+	}
+	for _, pair := range testPairs {
+		result := fixtureDetector(pair.fixture).Detect()
+		if result.Hypervisor != pair.hypervisor {
+			t.Errorf("%v: hypervisor '%v' != '%v'", pair.fixture, result.Hypervisor, pair.hypervisor)
+		}
+		if result.Container != pair.container {
+			t.Errorf("%v: container '%v' != '%v'", pair.fixture, result.Container, pair.container)
+		}
+		if result.Virtual() != pair.virtual {
+			t.Errorf("%v: virtual '%v' != '%v'", pair.fixture, result.Virtual(), pair.virtual)
+		}
+		if result.IsVirtual() != pair.isVirtual {
+			t.Errorf("%v: is_virtual %v != %v", pair.fixture, result.IsVirtual(), pair.isVirtual)
+		}
+		if result.Nested() != pair.nested {
+			t.Errorf("%v: nested %v != %v", pair.fixture, result.Nested(), pair.nested)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package ufacter
+
+// Reporter sends facts into the channel followed by the last fact
+type Reporter func(facts chan<- Fact, volatile bool, extended bool)
+
+// Collect runs all reporters concurrently and returns reported facts, empty
+// values are dropped as well as volatile or extended facts when not wanted
+func Collect(reporters []Reporter, volatile bool, extended bool) []Fact {
+	result := make([]Fact, 0)
+	toClose := len(reporters)
+	if toClose <= 0 {
+		return result
+	}
+
+	// channel buffer hasn't measurable effect only for light formatters
+	factsCh := make(chan Fact, 1024)
+
+	// start all reporters
+	for _, r := range reporters {
+		go r(factsCh, volatile, extended)
+	}
+
+	// collect and wait for facts
+	for f := range factsCh {
+		if f.Name == nil {
+			toClose--
+		} else if f.Value != nil && f.Value != "" {
+			if (!volatile && f.Volatile) || (!extended && !f.Native) {
+				// skip
+			} else {
+				result = append(result, f)
+			}
+		}
+		if toClose <= 0 {
+			break
+		}
+	}
+	return result
+}
@@ -0,0 +1,47 @@
+package ufacter
+
+import (
+	"testing"
+)
+
+func testReporter(facts chan<- Fact, volatile bool, extended bool) {
+	facts <- NewStableFact("stable", "a")
+	facts <- NewVolatileFact("volatile", "b")
+	facts <- NewStableFactEx("extended", "c")
+	facts <- NewStableFact("", "d")
+	facts <- NewStableFact(nil, "e")
+	SendLastFact(facts)
+}
+
+type collectTPair struct {
+	volatile bool
+	extended bool
+	expected string
+}
+
+func TestCollect(t *testing.T) {
+	tests := []collectTPair{
+		{true, true, "aabbcc"},
+		{false, true, "aacc"},
+		{true, false, "aabb"},
+		{false, false, "aa"},
+	}
+	for _, pair := range tests {
+		names := map[string]int{}
+		for _, f := range Collect([]Reporter{testReporter, testReporter}, pair.volatile, pair.extended) {
+			names[f.NameDots()]++
+		}
+		out := ""
+		for _, name := range []string{"a", "b", "c", "d", "e"} {
+			for i := 0; i < names[name]; i++ {
+				out += name
+			}
+		}
+		if out != pair.expected {
+			t.Fatalf("%v != %v", out, pair.expected)
+		}
+	}
+	if len(Collect(nil, true, true)) != 0 {
+		t.Fatalf("expected no facts")
+	}
+}
@@ -0,0 +1,145 @@
+package ufacter
+
+import (
+	j "encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Compatibility statuses of facter facts
+const (
+	CompatIdentical = "identical"
+	CompatValue     = "value"
+	CompatType      = "type"
+	CompatMissing   = "missing"
+)
+
+// CompatFact is compatibility status of one facter fact
+type CompatFact struct {
+	Name    string      `json:"name" yaml:"name"`
+	Status  string      `json:"status" yaml:"status"`
+	Facter  interface{} `json:"facter,omitempty" yaml:"facter,omitempty"`
+	Ufacter interface{} `json:"ufacter,omitempty" yaml:"ufacter,omitempty"`
+}
+
+// CompatTree is compatibility summary of a top-level fact tree
+type CompatTree struct {
+	Name      string  `json:"name" yaml:"name"`
+	Total     int     `json:"total" yaml:"total"`
+	Identical int     `json:"identical" yaml:"identical"`
+	Value     int     `json:"value" yaml:"value"`
+	Type      int     `json:"type" yaml:"type"`
+	Missing   int     `json:"missing" yaml:"missing"`
+	Percent   float64 `json:"percent" yaml:"percent"`
+}
+
+// FlattenFacts returns facts by name in dot format represented the same way
+// as facts loaded via LoadSnapshot from JSON
+func FlattenFacts(facts []Fact) (map[string]interface{}, error) {
+	formatter := NewJSONFormatter()
+	for _, f := range facts {
+		formatter.Add(f)
+	}
+	data, err := j.Marshal(formatter.data)
+	if err != nil {
+		return nil, err
+	}
+	tree := make(map[string]interface{})
+	if err := j.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	result := make(map[string]interface{})
+	flatten(result, "", tree)
+	return result, nil
+}
+
+// jsonKind returns JSON type of a normalized value
+func jsonKind(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+// Compat compares facter facts with ufacter facts, both flattened, and
+// returns status of every facter fact sorted by name
+func Compat(facter map[string]interface{}, ufacter map[string]interface{}) []CompatFact {
+	result := make([]CompatFact, 0, len(facter))
+	for name, value := range facter {
+		c := CompatFact{Name: name, Facter: value}
+		if uvalue, ok := ufacter[name]; ok {
+			c.Ufacter = uvalue
+			if reflect.DeepEqual(value, uvalue) {
+				c.Status = CompatIdentical
+				c.Facter = nil
+				c.Ufacter = nil
+			} else if jsonKind(value) != jsonKind(uvalue) {
+				c.Status = CompatType
+			} else {
+				c.Status = CompatValue
+			}
+		} else {
+			c.Status = CompatMissing
+			// ufacter reports a structure where facter has a value
+			for uname := range ufacter {
+				if strings.HasPrefix(uname, name+".") {
+					c.Status = CompatType
+					break
+				}
+			}
+		}
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// CompatTrees summarizes compatibility by top-level fact tree sorted by name,
+// the last element is the total of all trees named "total"
+func CompatTrees(facts []CompatFact) []CompatTree {
+	trees := make(map[string]*CompatTree)
+	total := CompatTree{Name: "total"}
+	for _, f := range facts {
+		name := strings.SplitN(f.Name, ".", 2)[0]
+		t, ok := trees[name]
+		if !ok {
+			t = &CompatTree{Name: name}
+			trees[name] = t
+		}
+		for _, s := range []*CompatTree{t, &total} {
+			s.Total++
+			switch f.Status {
+			case CompatIdentical:
+				s.Identical++
+			case CompatValue:
+				s.Value++
+			case CompatType:
+				s.Type++
+			case CompatMissing:
+				s.Missing++
+			}
+		}
+	}
+	result := make([]CompatTree, 0, len(trees)+1)
+	for _, t := range trees {
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	result = append(result, total)
+	for i := range result {
+		if result[i].Total > 0 {
+			result[i].Percent = float64(result[i].Identical) * 100 / float64(result[i].Total)
+		}
+	}
+	return result
+}
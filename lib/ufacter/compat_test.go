@@ -0,0 +1,59 @@
+package ufacter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompat(t *testing.T) {
+	facter := map[string]interface{}{
+		"os.family":           "RedHat",
+		"os.name":             "Fedora",
+		"processors.count":    float64(4),
+		"processors.isa":      "x86_64",
+		"memory.swap.total":   "1 GiB",
+		"networking.dhcp":     "10.0.0.1",
+		"networking.mtu":      float64(1500),
+		"networking.bindings": []interface{}{"10.0.0.2"},
+	}
+	native, err := FlattenFacts([]Fact{
+		NewStableFact("RedHat", "os", "family"),
+		NewStableFact("fedora", "os", "name"),
+		NewStableFact(uint32(4), "processors", "count"),
+		NewStableFact("x86_64", "processors", "isa"),
+		NewStableFact("1500", "networking", "mtu"),
+		NewStableFact("10.0.0.2", "networking", "bindings", "address"),
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	statuses := make(map[string]string)
+	for _, c := range Compat(facter, native) {
+		statuses[c.Name] = c.Status
+	}
+	expected := map[string]string{
+		"os.family":           CompatIdentical,
+		"os.name":             CompatValue,
+		"processors.count":    CompatIdentical,
+		"processors.isa":      CompatIdentical,
+		"memory.swap.total":   CompatMissing,
+		"networking.dhcp":     CompatMissing,
+		"networking.mtu":      CompatType,
+		"networking.bindings": CompatType,
+	}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Fatalf("%v != %v", statuses, expected)
+	}
+
+	trees := CompatTrees(Compat(facter, native))
+	expectedTrees := []CompatTree{
+		{Name: "memory", Total: 1, Missing: 1},
+		{Name: "networking", Total: 3, Type: 2, Missing: 1},
+		{Name: "os", Total: 2, Identical: 1, Value: 1, Percent: 50},
+		{Name: "processors", Total: 2, Identical: 2, Percent: 100},
+		{Name: "total", Total: 8, Identical: 3, Value: 1, Type: 2, Missing: 2, Percent: 37.5},
+	}
+	if !reflect.DeepEqual(trees, expectedTrees) {
+		t.Fatalf("%v != %v", trees, expectedTrees)
+	}
+}
@@ -0,0 +1,134 @@
+package ufacter
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change kinds
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// Change is a difference of one fact between two sets of facts
+type Change struct {
+	Name string      `json:"name" yaml:"name"`
+	Kind string      `json:"kind" yaml:"kind"`
+	Old  interface{} `json:"old,omitempty" yaml:"old,omitempty"`
+	New  interface{} `json:"new,omitempty" yaml:"new,omitempty"`
+}
+
+// FactMap returns values by fact name in dot format, volatile facts are
+// skipped unless requested
+func FactMap(facts []Fact, volatile bool) map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, f := range facts {
+		if f.Name == nil || (f.Volatile && !volatile) {
+			continue
+		}
+		result[f.NameDots()] = f.Value
+	}
+	return result
+}
+
+// Diff returns changes between two fact maps sorted by name
+func Diff(old map[string]interface{}, new map[string]interface{}) []Change {
+	result := make([]Change, 0)
+	for name, value := range old {
+		newValue, ok := new[name]
+		if !ok {
+			result = append(result, Change{Name: name, Kind: ChangeRemoved, Old: value})
+		} else if !reflect.DeepEqual(value, newValue) {
+			result = append(result, Change{Name: name, Kind: ChangeChanged, Old: value, New: newValue})
+		}
+	}
+	for name, value := range new {
+		if _, ok := old[name]; !ok {
+			result = append(result, Change{Name: name, Kind: ChangeAdded, New: value})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// VolatilePaths are names of facts which ufacter reports as volatile for
+// snapshots which do not carry the volatile flag, "*" matches any part of a
+// name including dots (e.g. partition devices); golden tests check names of
+// all volatile facts reporters create are listed
+var VolatilePaths = []string{
+	"ufacter.stats.*",
+	"system_uptime.*",
+	"load_averages.*",
+	"processes.count",
+	"processes.threads",
+	"processes.zombies",
+	"file_handles.used",
+	"file_handles.used_percent",
+	"entropy.available",
+	"kernelmodules.*.refcount",
+	"disks.total_size",
+	"partitions.*.capacity",
+	"partitions.*.available",
+	"partitions.*.available_bytes",
+	"partitions.*.used",
+	"partitions.*.used_bytes",
+	"memory.system.capacity",
+	"memory.system.available",
+	"memory.system.available_bytes",
+	"memory.system.used",
+	"memory.system.used_bytes",
+	"memory.swap.capacity",
+	"memory.swap.available",
+	"memory.swap.available_bytes",
+	"memory.swap.used",
+	"memory.swap.used_bytes",
+	"memory.swap.devices.*.used_bytes",
+	"memory.hugepages.sizes.*.free",
+	"memory.hugepages.sizes.*.reserved",
+	"memory.numa.*.free",
+	"memory.numa.*.free_bytes",
+	"link.*.stats.*",
+	"link.*.bond_slave.link_failure_count",
+	"link.*.wireguard.peers.*.latest_handshake",
+	"link.*.wireguard.peers.*.rx_bytes",
+	"link.*.wireguard.peers.*.tx_bytes",
+	"services.units.*.sub",
+	// link facts of network namespaces
+	"netns.*.link.*.stats.*",
+	"netns.*.link.*.bond_slave.link_failure_count",
+}
+
+// matchWildcard returns true when name matches pattern where "*" matches any
+// sequence of characters
+func matchWildcard(pattern string, name string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == name
+	}
+	last := len(parts) - 1
+	if !strings.HasPrefix(name, parts[0]) || !strings.HasSuffix(name, parts[last]) {
+		return false
+	}
+	rest := name[len(parts[0]):]
+	for _, part := range parts[1:last] {
+		i := strings.Index(rest, part)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(part):]
+	}
+	return len(rest) >= len(parts[last])
+}
+
+// IsVolatilePath returns true when fact name matches any of VolatilePaths
+func IsVolatilePath(name string) bool {
+	for _, p := range VolatilePaths {
+		if matchWildcard(p, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package ufacter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFactMap(t *testing.T) {
+	facts := []Fact{
+		NewStableFact("web01", "networking", "hostname"),
+		NewVolatileFact(42, "memory", "system", "used_bytes"),
+		NewLastFact(),
+	}
+	result := FactMap(facts, false)
+	expected := map[string]interface{}{"networking.hostname": "web01"}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+	if len(FactMap(facts, true)) != 2 {
+		t.Fatalf("volatile facts missing")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := map[string]interface{}{
+		"a": 1,
+		"b": []string{"x"},
+		"c": "removed",
+	}
+	new := map[string]interface{}{
+		"a": 1,
+		"b": []string{"x", "y"},
+		"d": "added",
+	}
+	result := Diff(old, new)
+	expected := []Change{
+		{Name: "b", Kind: ChangeChanged, Old: []string{"x"}, New: []string{"x", "y"}},
+		{Name: "c", Kind: ChangeRemoved, Old: "removed"},
+		{Name: "d", Kind: ChangeAdded, New: "added"},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+	if len(Diff(new, new)) != 0 {
+		t.Fatalf("expected no changes")
+	}
+}
+
+type isVolatilePathTPair struct {
+	in  string
+	out bool
+}
+
+func TestIsVolatilePath(t *testing.T) {
+	tests := []isVolatilePathTPair{
+		{"ufacter.stats.cpu", true},
+		{"system_uptime.days", true},
+		{"partitions./dev/mapper/cs-root.used_bytes", true},
+		{"partitions./dev/sda1.size", false},
+		{"memory.system.used", true},
+		{"memory.system.total", false},
+		{"link.eth0.stats.rx_bytes", true},
+		{"link.eth0.mtu", false},
+		{"link.wg0.wireguard.peers.abc=.rx_bytes", true},
+		{"services.units.sshd.service.sub", true},
+		{"services.units.sshd.service.active", false},
+		{"ufacter.version", false},
+	}
+	for _, pair := range tests {
+		out := IsVolatilePath(pair.in)
+		if out != pair.out {
+			t.Fatalf("%s: %v != %v", pair.in, out, pair.out)
+		}
+	}
+}
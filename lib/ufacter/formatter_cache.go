@@ -0,0 +1,127 @@
+package ufacter
+
+import (
+	"crypto/sha256"
+	j "encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DefaultCacheFile is the facter external facts file
+const DefaultCacheFile = "/etc/facter/facts.d/ufacter.json"
+
+// CacheFormatter writes facts in JSON format into a file which is replaced
+// atomically, checksum of stable facts is stored as ufacter.checksum fact
+type CacheFormatter struct {
+	filename    string
+	prefix      string
+	onlyChanged bool
+	all         *JSONFormatter
+	stable      *JSONFormatter
+	written     bool
+	err         error
+}
+
+// NewCacheFormatter returns formatter writing into filename, all facts are
+// nested under prefix when not empty and the file is only written when
+// stable facts changed if onlyChanged is set
+func NewCacheFormatter(filename string, prefix string, onlyChanged bool) *CacheFormatter {
+	return &CacheFormatter{
+		filename:    filename,
+		prefix:      prefix,
+		onlyChanged: onlyChanged,
+		all:         NewJSONFormatter(),
+		stable:      NewJSONFormatter(),
+	}
+}
+
+// name returns fact name with prefix
+func (cf *CacheFormatter) name(keys ...string) []string {
+	if cf.prefix == "" {
+		return keys
+	}
+	return append([]string{cf.prefix}, keys...)
+}
+
+func (cf *CacheFormatter) Add(f Fact) {
+	f.Name = cf.name(f.Name...)
+	cf.all.Add(f)
+	if !f.Volatile {
+		cf.stable.Add(f)
+	}
+}
+
+// Checksum returns SHA-256 of stable facts, JSON encoder sorts keys
+func (cf *CacheFormatter) Checksum() string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(cf.stable.JSONString())))
+}
+
+// storedChecksum returns checksum from existing file or empty string
+func (cf *CacheFormatter) storedChecksum() string {
+	contents, err := ioutil.ReadFile(cf.filename)
+	if err != nil {
+		return ""
+	}
+	var data interface{}
+	if err := j.Unmarshal(contents, &data); err != nil {
+		return ""
+	}
+	for _, key := range cf.name("ufacter", "checksum") {
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		data = m[key]
+	}
+	checksum, _ := data.(string)
+	return checksum
+}
+
+func (cf *CacheFormatter) Finish() {
+	checksum := cf.Checksum()
+	if cf.onlyChanged && checksum == cf.storedChecksum() {
+		return
+	}
+	cf.all.Add(NewStableFactEx(checksum, cf.name("ufacter", "checksum")...))
+	cf.err = WriteFileAtomic(cf.filename, []byte(cf.all.IntentJSONString()), 0644)
+	cf.written = cf.err == nil
+}
+
+// Written returns true when the file was replaced by Finish
+func (cf *CacheFormatter) Written() bool {
+	return cf.written
+}
+
+// Err returns error from writing the file
+func (cf *CacheFormatter) Err() error {
+	return cf.err
+}
+
+// WriteFileAtomic writes data into temporary file in the same directory
+// and renames it so readers never see a partial file
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,58 @@
+package ufacter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeCache(filename string, hostname string, free int) *CacheFormatter {
+	f := NewCacheFormatter(filename, "uf", true)
+	f.Add(NewStableFact(hostname, "networking", "hostname"))
+	f.Add(NewVolatileFact(free, "memory", "system", "available_bytes"))
+	f.Finish()
+	return f
+}
+
+func TestCacheFormatter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ufacter")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ufacter.json")
+
+	f := writeCache(filename, "web01", 1)
+	if f.Err() != nil || !f.Written() {
+		t.Fatalf("file not written: %v", f.Err())
+	}
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !strings.Contains(string(contents), `"uf": {`) || !strings.Contains(string(contents), f.Checksum()) {
+		t.Fatalf("unexpected contents %s", contents)
+	}
+
+	// volatile change only
+	if f = writeCache(filename, "web01", 2); f.Written() {
+		t.Fatalf("file written without stable change")
+	}
+	if f = writeCache(filename, "web02", 2); !f.Written() {
+		t.Fatalf("file not written after stable change")
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("temporary files left: %v %v", entries, err)
+	}
+}
+
+func TestWriteFileAtomicMissingDir(t *testing.T) {
+	err := WriteFileAtomic(filepath.Join("nonexistent", "dir", "file.json"), []byte("{}"), 0644)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+}
@@ -0,0 +1,214 @@
+package ufacter
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// legacyRule derives flat legacy fact from structured fact
+type legacyRule struct {
+	// Structured name in dot format, * matches any single key
+	pattern string
+	// Flat name, %s is replaced with key matched by * (sanitized)
+	name string
+	// Optional conversion, facts are skipped when it returns nil
+	convert func(interface{}) interface{}
+	// Value is a list and one fact with index appended to name is created per item
+	each bool
+}
+
+// legacyList creates comma separated list of keys matched by * in pattern
+type legacyList struct {
+	pattern string
+	name    string
+}
+
+var legacyRules = []legacyRule{
+	{pattern: "networking.hostname", name: "hostname"},
+	{pattern: "networking.domain", name: "domain"},
+	{pattern: "networking.fqdn", name: "fqdn"},
+	{pattern: "networking.ip", name: "ipaddress"},
+	{pattern: "networking.ip6", name: "ipaddress6"},
+	{pattern: "networking.mac", name: "macaddress"},
+	{pattern: "networking.netmask", name: "netmask"},
+	{pattern: "networking.netmask6", name: "netmask6"},
+	{pattern: "networking.network", name: "network"},
+	{pattern: "networking.network6", name: "network6"},
+	{pattern: "networking.interfaces.*.mac", name: "macaddress_%s"},
+	{pattern: "networking.interfaces.*.mtu", name: "mtu_%s"},
+	{pattern: "networking.interfaces.*.bindings", name: "ipaddress_%s", convert: firstBinding("address")},
+	{pattern: "networking.interfaces.*.bindings", name: "netmask_%s", convert: firstBinding("netmask")},
+	{pattern: "networking.interfaces.*.bindings", name: "network_%s", convert: firstBinding("network")},
+	{pattern: "networking.interfaces.*.bindings6", name: "ipaddress6_%s", convert: firstBinding("address")},
+	{pattern: "networking.interfaces.*.bindings6", name: "netmask6_%s", convert: firstBinding("netmask")},
+	{pattern: "networking.interfaces.*.bindings6", name: "network6_%s", convert: firstBinding("network")},
+	{pattern: "memory.system.total", name: "memorysize"},
+	{pattern: "memory.system.total_bytes", name: "memorysize_mb", convert: toMegabytes},
+	{pattern: "memory.system.available", name: "memoryfree"},
+	{pattern: "memory.system.available_bytes", name: "memoryfree_mb", convert: toMegabytes},
+	{pattern: "memory.swap.total", name: "swapsize"},
+	{pattern: "memory.swap.total_bytes", name: "swapsize_mb", convert: toMegabytes},
+	{pattern: "memory.swap.available", name: "swapfree"},
+	{pattern: "memory.swap.available_bytes", name: "swapfree_mb", convert: toMegabytes},
+	{pattern: "processors.count", name: "processorcount"},
+	{pattern: "processors.physicalcount", name: "physicalprocessorcount"},
+	{pattern: "processors.models", name: "processor", each: true},
+	{pattern: "processors.isa", name: "hardwareisa"},
+	{pattern: "os.architecture", name: "architecture"},
+	{pattern: "os.hardware", name: "hardwaremodel"},
+	{pattern: "os.name", name: "operatingsystem"},
+	{pattern: "os.family", name: "osfamily"},
+	{pattern: "os.release.full", name: "operatingsystemrelease"},
+	{pattern: "os.release.major", name: "operatingsystemmajrelease"},
+	{pattern: "system_uptime.uptime", name: "uptime"},
+	{pattern: "system_uptime.seconds", name: "uptime_seconds"},
+	{pattern: "system_uptime.hours", name: "uptime_hours"},
+	{pattern: "system_uptime.days", name: "uptime_days"},
+	{pattern: "disks.*.size_bytes", name: "blockdevice_%s_size"},
+	{pattern: "disks.*.model", name: "blockdevice_%s_model"},
+	{pattern: "disks.*.vendor", name: "blockdevice_%s_vendor"},
+}
+
+var legacyLists = []legacyList{
+	{pattern: "networking.interfaces.*.mtu", name: "interfaces"},
+	{pattern: "disks.*.size_bytes", name: "blockdevices"},
+}
+
+// legacyKeyRe matches characters facter replaces in legacy fact names
+var legacyKeyRe = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// firstBinding returns conversion extracting field of the first binding
+func firstBinding(field string) func(interface{}) interface{} {
+	return func(value interface{}) interface{} {
+		v := reflect.ValueOf(value)
+		if v.Kind() != reflect.Slice || v.Len() == 0 {
+			return nil
+		}
+		first := reflect.Indirect(v.Index(0))
+		if first.Kind() == reflect.Interface {
+			first = first.Elem()
+		}
+		if first.Kind() != reflect.Map {
+			return nil
+		}
+		item := first.MapIndex(reflect.ValueOf(field))
+		if !item.IsValid() {
+			return nil
+		}
+		return item.Interface()
+	}
+}
+
+// toMegabytes converts bytes to mebibytes with two decimal places
+func toMegabytes(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	var bytes float64
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		bytes = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		bytes = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		bytes = v.Float()
+	default:
+		return nil
+	}
+	return math.Round(bytes/1024/1024*100) / 100
+}
+
+// matchLegacy matches fact name against pattern and returns key matched by *
+func matchLegacy(pattern []string, name []string) (string, bool) {
+	if len(pattern) != len(name) {
+		return "", false
+	}
+	key := ""
+	for i, p := range pattern {
+		if p == "*" {
+			key = name[i]
+		} else if p != name[i] {
+			return "", false
+		}
+	}
+	return key, true
+}
+
+// LegacyFormatter adds facter 2.x flat facts derived from structured facts
+// and passes everything to another formatter
+type LegacyFormatter struct {
+	formatter Formatter
+	facts     []Fact
+}
+
+// NewLegacyFormatter returns formatter wrapping another formatter
+func NewLegacyFormatter(formatter Formatter) *LegacyFormatter {
+	return &LegacyFormatter{
+		formatter: formatter,
+		facts:     make([]Fact, 0),
+	}
+}
+
+func (lf *LegacyFormatter) Add(f Fact) {
+	lf.formatter.Add(f)
+	lf.facts = append(lf.facts, f)
+}
+
+// LegacyFacts returns flat facts derived from facts added so far
+func (lf *LegacyFormatter) LegacyFacts() []Fact {
+	result := make([]Fact, 0)
+	for _, rule := range legacyRules {
+		pattern := strings.Split(rule.pattern, ".")
+		for _, f := range lf.facts {
+			key, ok := matchLegacy(pattern, f.Name)
+			if !ok {
+				continue
+			}
+			name := rule.name
+			if strings.Contains(name, "%s") {
+				name = fmt.Sprintf(name, legacyKeyRe.ReplaceAllString(key, "_"))
+			}
+			value := f.Value
+			if rule.convert != nil {
+				value = rule.convert(value)
+			}
+			if value == nil {
+				continue
+			}
+			if rule.each {
+				v := reflect.ValueOf(value)
+				if v.Kind() != reflect.Slice {
+					continue
+				}
+				for i := 0; i < v.Len(); i++ {
+					result = append(result, NewFact(v.Index(i).Interface(), f.Volatile, fmt.Sprintf("%s%d", name, i)))
+				}
+				continue
+			}
+			result = append(result, NewFact(value, f.Volatile, name))
+		}
+	}
+	for _, list := range legacyLists {
+		pattern := strings.Split(list.pattern, ".")
+		keys := []string{}
+		for _, f := range lf.facts {
+			if key, ok := matchLegacy(pattern, f.Name); ok {
+				keys = append(keys, legacyKeyRe.ReplaceAllString(key, "_"))
+			}
+		}
+		if len(keys) > 0 {
+			sort.Strings(keys)
+			result = append(result, NewStableFact(strings.Join(keys, ","), list.name))
+		}
+	}
+	return result
+}
+
+func (lf *LegacyFormatter) Finish() {
+	for _, f := range lf.LegacyFacts() {
+		lf.formatter.Add(f)
+	}
+	lf.formatter.Finish()
+}
@@ -0,0 +1,87 @@
+package ufacter
+
+import (
+	"reflect"
+	"testing"
+)
+
+// nullFormatter discards facts
+type nullFormatter struct{}
+
+func (nf *nullFormatter) Add(Fact) {}
+
+func (nf *nullFormatter) Finish() {}
+
+type bindingMap map[string]string
+
+func TestLegacyFacts(t *testing.T) {
+	f := NewLegacyFormatter(&nullFormatter{})
+	f.Add(NewStableFact("web01", "networking", "hostname"))
+	f.Add(NewStableFact("192.0.2.10", "networking", "ip"))
+	f.Add(NewStableFact("52:54:00:aa:bb:cc", "networking", "interfaces", "bond0.10", "mac"))
+	f.Add(NewStableFact(1500, "networking", "interfaces", "bond0.10", "mtu"))
+	f.Add(NewStableFact(65536, "networking", "interfaces", "lo", "mtu"))
+	f.Add(NewStableFact([]bindingMap{{"address": "192.0.2.10", "netmask": "255.255.255.0", "network": "192.0.2.0"}},
+		"networking", "interfaces", "bond0.10", "bindings"))
+	f.Add(NewStableFact(uint64(16638554112), "memory", "system", "total_bytes"))
+	f.Add(NewVolatileFact(uint64(1073741824), "memory", "system", "available_bytes"))
+	f.Add(NewStableFact(2, "processors", "count"))
+	f.Add(NewStableFact([]string{"Xeon A", "Xeon B"}, "processors", "models"))
+	f.Add(NewStableFact("RedHat", "os", "family"))
+	f.Add(NewStableFact(int64(512110190592), "disks", "sda", "size_bytes"))
+	f.Add(NewStableFact(int64(1073741824), "disks", "vda", "size_bytes"))
+	f.Add(NewStableFact("ignored", "disks", "sda", "size_bytes", "extra"))
+
+	result := make(map[string]interface{})
+	volatile := make(map[string]bool)
+	for _, fact := range f.LegacyFacts() {
+		result[fact.NameDots()] = fact.Value
+		volatile[fact.NameDots()] = fact.Volatile
+	}
+	expected := map[string]interface{}{
+		"hostname":             "web01",
+		"ipaddress":            "192.0.2.10",
+		"macaddress_bond0_10":  "52:54:00:aa:bb:cc",
+		"mtu_bond0_10":         1500,
+		"mtu_lo":               65536,
+		"ipaddress_bond0_10":   "192.0.2.10",
+		"netmask_bond0_10":     "255.255.255.0",
+		"network_bond0_10":     "192.0.2.0",
+		"memorysize_mb":        15867.76,
+		"memoryfree_mb":        1024.0,
+		"processorcount":       2,
+		"processor0":           "Xeon A",
+		"processor1":           "Xeon B",
+		"osfamily":             "RedHat",
+		"blockdevice_sda_size": int64(512110190592),
+		"blockdevice_vda_size": int64(1073741824),
+		"interfaces":           "bond0_10,lo",
+		"blockdevices":         "sda,vda",
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("%v != %v", result, expected)
+	}
+	if !volatile["memoryfree_mb"] || volatile["memorysize_mb"] {
+		t.Fatalf("volatile flag not preserved")
+	}
+}
+
+type firstBindingTPair struct {
+	in  interface{}
+	out interface{}
+}
+
+func TestFirstBinding(t *testing.T) {
+	tests := []firstBindingTPair{
+		{[]map[string]string{{"address": "::1"}}, "::1"},
+		{[]map[string]interface{}{{"netmask": "255.0.0.0"}}, nil},
+		{[]map[string]string{}, nil},
+		{"garbage", nil},
+	}
+	for _, pair := range tests {
+		out := firstBinding("address")(pair.in)
+		if out != pair.out {
+			t.Fatalf("%v != %v", out, pair.out)
+		}
+	}
+}
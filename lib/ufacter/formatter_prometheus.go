@@ -0,0 +1,113 @@
+package ufacter
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metricNameRe matches characters not allowed in Prometheus metric names
+var metricNameRe = regexp.MustCompile("[^a-zA-Z0-9_]")
+
+// PrometheusFormatter prints-out facts in Prometheus text format, numeric
+// and boolean facts are gauges named after the top-level fact with the rest
+// of the path as label, scalar non-numeric facts are _info metrics
+type PrometheusFormatter struct {
+	// samples by metric name and labels, a series is reported only once
+	metrics map[string]map[string]string
+}
+
+// NewPrometheusFormatter returns new Prometheus formatter
+func NewPrometheusFormatter() *PrometheusFormatter {
+	return &PrometheusFormatter{
+		metrics: make(map[string]map[string]string),
+	}
+}
+
+// escapeLabel escapes label value as required by the text format
+func escapeLabel(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return strings.Replace(value, "\n", `\n`, -1)
+}
+
+// numericValue returns float value of numeric and boolean facts
+func numericValue(value interface{}) (float64, bool) {
+	if d, ok := value.(time.Duration); ok {
+		return d.Seconds(), true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return 1, true
+		}
+		return 0, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func (pf *PrometheusFormatter) add(name string, labels string, value string) {
+	if _, ok := pf.metrics[name]; !ok {
+		pf.metrics[name] = make(map[string]string)
+	}
+	pf.metrics[name][labels] = value
+}
+
+func (pf *PrometheusFormatter) Add(f Fact) {
+	if len(f.Name) == 0 {
+		return
+	}
+	name := "ufacter_" + metricNameRe.ReplaceAllString(f.Name[0], "_")
+	path := escapeLabel(strings.Join(f.Name[1:], "."))
+	if number, ok := numericValue(f.Value); ok {
+		pf.add(name, fmt.Sprintf(`path="%s"`, path), strconv.FormatFloat(number, 'g', -1, 64))
+		return
+	}
+	value := f.Value
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct, reflect.Ptr, reflect.Invalid:
+		// structured values have no reasonable representation
+		return
+	}
+	pf.add(name+"_info", fmt.Sprintf(`path="%s",value="%s"`, path, escapeLabel(fmt.Sprint(value))), "1")
+}
+
+// PrometheusString returns metrics sorted by name
+func (pf *PrometheusFormatter) PrometheusString() string {
+	names := make([]string, 0, len(pf.metrics))
+	for name := range pf.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+		labels := make([]string, 0, len(pf.metrics[name]))
+		for l := range pf.metrics[name] {
+			labels = append(labels, l)
+		}
+		sort.Strings(labels)
+		for _, l := range labels {
+			fmt.Fprintf(&b, "%s{%s} %s\n", name, l, pf.metrics[name][l])
+		}
+	}
+	return b.String()
+}
+
+func (pf *PrometheusFormatter) Finish() {
+	fmt.Print(pf.PrometheusString())
+}
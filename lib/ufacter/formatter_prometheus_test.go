@@ -0,0 +1,38 @@
+package ufacter
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPrometheusFormatter(t *testing.T) {
+	f := NewPrometheusFormatter()
+	f.Add(NewStableFact(uint64(6305947648), "memory", "system", "total_bytes"))
+	f.Add(NewStableFact(1500, "networking", "interfaces", "bond0.10", "mtu"))
+	f.Add(NewStableFact(1500, "networking", "interfaces", "bond0.10", "mtu"))
+	f.Add(NewStableFact(true, "is_virtual"))
+	f.Add(NewStableFact("Linux", "kernel"))
+	f.Add(NewStableFact(`say "hi"`, "custom-fact", "motd"))
+	f.Add(NewStableFact([]string{"a"}, "processors", "models"))
+	f.Add(NewStableFact(errors.New("failed"), "ufacter", "errors", "cpu"))
+	f.Add(NewVolatileFactEx(1500*time.Millisecond, "ufacter", "stats", "cpu"))
+	expected := `# TYPE ufacter_custom_fact_info gauge
+ufacter_custom_fact_info{path="motd",value="say \"hi\""} 1
+# TYPE ufacter_is_virtual gauge
+ufacter_is_virtual{path=""} 1
+# TYPE ufacter_kernel_info gauge
+ufacter_kernel_info{path="",value="Linux"} 1
+# TYPE ufacter_memory gauge
+ufacter_memory{path="system.total_bytes"} 6.305947648e+09
+# TYPE ufacter_networking gauge
+ufacter_networking{path="interfaces.bond0.10.mtu"} 1500
+# TYPE ufacter_ufacter gauge
+ufacter_ufacter{path="stats.cpu"} 1.5
+# TYPE ufacter_ufacter_info gauge
+ufacter_ufacter_info{path="errors.cpu",value="failed"} 1
+`
+	if out := f.PrometheusString(); out != expected {
+		t.Fatalf("%v != %v", out, expected)
+	}
+}
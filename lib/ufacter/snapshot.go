@@ -0,0 +1,86 @@
+package ufacter
+
+import (
+	j "encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadSnapshot reads facts printed by ufacter or facter in JSON or YAML
+// format and returns them flattened by name in dot format, the format is
+// detected from file extension and JSON is tried first for other files
+func LoadSnapshot(filename string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	tree := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		err = j.Unmarshal(data, &tree)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	default:
+		if err = j.Unmarshal(data, &tree); err != nil {
+			err = yaml.Unmarshal(data, &tree)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	result := make(map[string]interface{})
+	flatten(result, "", tree)
+	return result, nil
+}
+
+// flatten stores leaf values of nested maps by name in dot format, lists are
+// leaf values
+func flatten(result map[string]interface{}, prefix string, value interface{}) {
+	value = normalize(value)
+	m, ok := value.(map[string]interface{})
+	if !ok || (len(m) == 0 && prefix != "") {
+		result[prefix] = value
+		return
+	}
+	for key, v := range m {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+		flatten(result, name, v)
+	}
+}
+
+// normalize converts numbers to float64 and map keys to strings so values
+// decoded from JSON and YAML can be compared
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = normalize(item)
+		}
+		return result
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[fmt.Sprint(key)] = normalize(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = normalize(item)
+		}
+		return result
+	}
+	if number, ok := numericValue(value); ok && reflect.ValueOf(value).Kind() != reflect.Bool {
+		return number
+	}
+	return value
+}
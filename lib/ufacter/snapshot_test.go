@@ -0,0 +1,75 @@
+package ufacter
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeSnapshot(t *testing.T, dir string, name string, content string) string {
+	filename := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return filename
+}
+
+func TestLoadSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ufacter")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	jsonFile := writeSnapshot(t, dir, "a.json", `{
+  "memory": {"system": {"total_bytes": 4096, "used": "1 KiB"}},
+  "processors": {"models": ["i7", "i7"]},
+  "ssh": {}
+}`)
+	yamlFile := writeSnapshot(t, dir, "b.yaml", `memory:
+  system:
+    total_bytes: 4096
+    used: 1 KiB
+processors:
+  models:
+  - i7
+  - i7
+ssh: {}
+`)
+	noExtFile := writeSnapshot(t, dir, "c", "memory:\n  system:\n    total_bytes: 4096.0\n")
+
+	a, err := LoadSnapshot(jsonFile)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	b, err := LoadSnapshot(yamlFile)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := map[string]interface{}{
+		"memory.system.total_bytes": float64(4096),
+		"memory.system.used":        "1 KiB",
+		"processors.models":         []interface{}{"i7", "i7"},
+		"ssh":                       map[string]interface{}{},
+	}
+	if !reflect.DeepEqual(a, expected) {
+		t.Fatalf("%v != %v", a, expected)
+	}
+	if changes := Diff(a, b); len(changes) != 0 {
+		t.Fatalf("JSON and YAML differ: %v", changes)
+	}
+
+	c, err := LoadSnapshot(noExtFile)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if changes := Diff(a, c); len(changes) != 3 {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+
+	if _, err := LoadSnapshot(writeSnapshot(t, dir, "d.json", "{")); err == nil {
+		t.Fatalf("expected parse error")
+	}
+}
@@ -0,0 +1,205 @@
+package ufacter
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	j "encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Uploader posts facts to Foreman /api/hosts/facts endpoint, payloads which
+// cannot be delivered are kept in spool directory and sent first next time
+type Uploader struct {
+	// Endpoint URL, user and password are sent via basic authentication
+	URL string
+	// Number of retries of failed requests
+	Retries int
+	// Delay before the first retry, doubled with every retry
+	Backoff time.Duration
+	// Directory for undelivered payloads, spooling is disabled when empty
+	SpoolDir string
+
+	client *http.Client
+}
+
+// NewUploader returns uploader with optional client certificate and CA
+func NewUploader(endpoint string, certFile string, keyFile string, caFile string) (*Uploader, error) {
+	config := &tls.Config{}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+	return &Uploader{
+		URL:     endpoint,
+		Retries: 3,
+		Backoff: time.Second,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: config, Proxy: http.ProxyFromEnvironment},
+		},
+	}, nil
+}
+
+// ForemanPayload returns facts in the format of Foreman facts upload, host
+// name is the fqdn fact
+func ForemanPayload(facts []Fact) ([]byte, error) {
+	formatter := NewJSONFormatter()
+	name := ""
+	hostname := ""
+	for _, f := range facts {
+		formatter.Add(f)
+		switch f.NameDots() {
+		case "networking.fqdn":
+			name, _ = f.Value.(string)
+		case "networking.hostname":
+			hostname, _ = f.Value.(string)
+		}
+	}
+	if name == "" {
+		name = hostname
+	}
+	if name == "" {
+		return nil, errors.New("networking.fqdn fact is missing (host module)")
+	}
+	formatter.data["_type"] = "puppet"
+	formatter.data["_timestamp"] = time.Now().UTC().Format(time.RFC3339)
+	return j.Marshal(map[string]interface{}{
+		"name":     name,
+		"certname": name,
+		"facts":    formatter.data,
+	})
+}
+
+// retryable errors are network errors, server errors and throttling
+type retryable struct {
+	err error
+}
+
+func (r retryable) Error() string {
+	return r.err.Error()
+}
+
+func (u *Uploader) post(payload []byte) error {
+	req, err := http.NewRequest("POST", u.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if parsed, err := url.Parse(u.URL); err == nil && parsed.User != nil {
+		password, _ := parsed.User.Password()
+		req.SetBasicAuth(parsed.User.Username(), password)
+	}
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return retryable{err}
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return retryable{err}
+	}
+	return err
+}
+
+// send posts payload and retries with exponential backoff
+func (u *Uploader) send(payload []byte) error {
+	delay := u.Backoff
+	var err error
+	for attempt := 0; attempt <= u.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		err = u.post(payload)
+		if _, ok := err.(retryable); !ok {
+			return err
+		}
+	}
+	return err
+}
+
+// spooled returns spooled payload files, oldest first
+func (u *Uploader) spooled() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(u.SpoolDir, "*.json"))
+	sort.Strings(files)
+	return files, err
+}
+
+func (u *Uploader) spool(payload []byte) error {
+	if err := os.MkdirAll(u.SpoolDir, 0700); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%020d.json", time.Now().UnixNano())
+	return WriteFileAtomic(filepath.Join(u.SpoolDir, name), payload, 0600)
+}
+
+// Upload sends spooled payloads and then the payload, when server cannot be
+// reached the payload is spooled
+func (u *Uploader) Upload(payload []byte) error {
+	if u.SpoolDir != "" {
+		files, err := u.spooled()
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			spooled, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			err = u.send(spooled)
+			if _, ok := err.(retryable); ok {
+				// still offline
+				if spoolErr := u.spool(payload); spoolErr != nil {
+					return spoolErr
+				}
+				return err
+			} else if err != nil {
+				// rejected by server, kept for inspection
+				if err := os.Rename(file, file+".rejected"); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := os.Remove(file); err != nil {
+				return err
+			}
+		}
+	}
+
+	err := u.send(payload)
+	if _, ok := err.(retryable); ok && u.SpoolDir != "" {
+		if spoolErr := u.spool(payload); spoolErr != nil {
+			return spoolErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,235 @@
+package ufacter
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	j "encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// foremanServer records uploads and fails first failures requests with status
+type foremanServer struct {
+	mutex    sync.Mutex
+	status   int
+	failures int
+	requests [][]byte
+	users    []string
+}
+
+func (fs *foremanServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	fs.requests = append(fs.requests, body)
+	user, _, _ := r.BasicAuth()
+	fs.users = append(fs.users, user)
+	if fs.failures > 0 {
+		fs.failures--
+		w.WriteHeader(fs.status)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func testUploader(t *testing.T, endpoint string) *Uploader {
+	u, err := NewUploader(endpoint, "", "", "")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	u.Backoff = time.Millisecond
+	return u
+}
+
+func TestForemanPayload(t *testing.T) {
+	payload, err := ForemanPayload([]Fact{
+		NewStableFact("web01.example.com", "networking", "fqdn"),
+		NewStableFact("web01", "networking", "hostname"),
+		NewStableFact("bond", "link", "bond0", "type"),
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	var data struct {
+		Name     string                 `json:"name"`
+		Certname string                 `json:"certname"`
+		Facts    map[string]interface{} `json:"facts"`
+	}
+	if err := j.Unmarshal(payload, &data); err != nil {
+		t.Fatalf("%v: %s", err, payload)
+	}
+	if data.Name != "web01.example.com" || data.Certname != data.Name || data.Facts["networking"].(map[string]interface{})["hostname"] != "web01" {
+		t.Fatalf("unexpected payload %s", payload)
+	}
+	if !strings.Contains(string(payload), `"_type":"puppet"`) {
+		t.Fatalf("importer type missing in %s", payload)
+	}
+	if _, err := ForemanPayload([]Fact{}); err == nil {
+		t.Fatalf("expected error without host name")
+	}
+}
+
+func TestUploadRetry(t *testing.T) {
+	fs := &foremanServer{status: http.StatusServiceUnavailable, failures: 2}
+	server := httptest.NewServer(fs)
+	defer server.Close()
+
+	u := testUploader(t, strings.Replace(server.URL, "http://", "http://admin:secret@", 1))
+	if err := u.Upload([]byte(`{}`)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(fs.requests) != 3 || fs.users[2] != "admin" {
+		t.Fatalf("unexpected requests %d users %v", len(fs.requests), fs.users)
+	}
+}
+
+func TestUploadRejected(t *testing.T) {
+	fs := &foremanServer{status: http.StatusUnprocessableEntity, failures: 1}
+	server := httptest.NewServer(fs)
+	defer server.Close()
+	dir, err := ioutil.TempDir("", "ufacter")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	u := testUploader(t, server.URL)
+	u.SpoolDir = dir
+	if err := u.Upload([]byte(`{}`)); err == nil || !strings.Contains(err.Error(), "422") {
+		t.Fatalf("expected 422 error, got %v", err)
+	}
+	if files, _ := u.spooled(); len(fs.requests) != 1 || len(files) != 0 {
+		t.Fatalf("rejected payload retried or spooled: %d %v", len(fs.requests), files)
+	}
+}
+
+func TestUploadSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ufacter")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// offline
+	fs := &foremanServer{}
+	server := httptest.NewServer(fs)
+	endpoint := server.URL
+	server.Close()
+	u := testUploader(t, endpoint)
+	u.Retries = 1
+	u.SpoolDir = filepath.Join(dir, "spool")
+	if err := u.Upload([]byte(`{"n":1}`)); err == nil {
+		t.Fatalf("expected error when offline")
+	}
+	if err := u.Upload([]byte(`{"n":2}`)); err == nil {
+		t.Fatalf("expected error when offline")
+	}
+	if files, _ := u.spooled(); len(files) != 2 {
+		t.Fatalf("expected two spooled payloads, got %v", files)
+	}
+
+	// online again
+	server = httptest.NewServer(fs)
+	defer server.Close()
+	u.URL = server.URL
+	if err := u.Upload([]byte(`{"n":3}`)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	sent := []string{}
+	for _, r := range fs.requests {
+		sent = append(sent, string(r))
+	}
+	if strings.Join(sent, ",") != `{"n":1},{"n":2},{"n":3}` {
+		t.Fatalf("unexpected order %v", sent)
+	}
+	if files, _ := u.spooled(); len(files) != 0 {
+		t.Fatalf("spool not empty %v", files)
+	}
+}
+
+// writePEM writes PEM block into file in dir
+func writePEM(t *testing.T, dir string, name string, kind string, der []byte) string {
+	filename := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(filename, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600); err != nil {
+		t.Fatalf("%v", err)
+	}
+	return filename
+}
+
+func TestUploadClientCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ufacter")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "web01.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	clientCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	fs := &foremanServer{}
+	server := httptest.NewUnstartedServer(fs)
+	clients := x509.NewCertPool()
+	clients.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clients}
+	server.StartTLS()
+	defer server.Close()
+
+	certFile := writePEM(t, dir, "cert.pem", "CERTIFICATE", der)
+	keyFile := writePEM(t, dir, "key.pem", "EC PRIVATE KEY", keyDer)
+	caFile := writePEM(t, dir, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+	// without client certificate
+	u, err := NewUploader(server.URL, "", "", caFile)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	u.Retries = 0
+	if err := u.Upload([]byte(`{}`)); err == nil {
+		t.Fatalf("expected TLS error without client certificate")
+	}
+
+	u, err = NewUploader(server.URL, certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := u.Upload([]byte(`{}`)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(fs.requests) != 1 {
+		t.Fatalf("unexpected requests %d", len(fs.requests))
+	}
+}